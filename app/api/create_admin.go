@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+)
+
+// runCreateAdmin handles `create-admin --username --email --password [--tenant] [--force]`,
+// which inserts an admin user directly so the first admin can be bootstrapped
+// without going through the HTTP API.
+func runCreateAdmin(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := fs.String("username", "", "admin username")
+	email := fs.String("email", "", "admin email")
+	password := fs.String("password", "", "admin password")
+	tenantID := fs.Uint("tenant", 0, "tenant the admin belongs to")
+	force := fs.Bool("force", false, "create the admin even if one already exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *username == "" || *email == "" || *password == "" {
+		return errors.New("--username, --email and --password are required")
+	}
+	if err := utils.ValidatePasswordStrength(*password); err != nil {
+		return err
+	}
+	if len(*password) > utils.PasswordMaxBytes {
+		return fmt.Errorf("password must be at most %d bytes", utils.PasswordMaxBytes)
+	}
+
+	if err := config.ConnectDB(cfg.Database); err != nil {
+		return err
+	}
+
+	var admins int64
+	if err := config.DB.Model(&models.User{}).Where("role = ? AND tenant_id = ?", "admin", *tenantID).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 && !*force {
+		return errors.New("an admin user already exists, pass --force to create another one")
+	}
+
+	hashedPassword, err := utils.HashPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	admin := models.User{
+		Username:      *username,
+		Email:         *email,
+		PasswordHash:  hashedPassword,
+		Role:          "admin",
+		TenantID:      *tenantID,
+		EmailVerified: true,
+	}
+	if err := config.DB.Create(&admin).Error; err != nil {
+		return err
+	}
+
+	fmt.Printf("Admin user %q created with id %d\n", admin.Username, admin.ID)
+	return nil
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CreateApiKeyRequest struct {
+	Client string `json:"client" validate:"required,max=100"`
+	// Scope is space-delimited, e.g. "profile:read apikeys:read". A key can
+	// only create keys within its own scope.
+	Scope     string     `json:"scope" validate:"max=255"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// RateLimit is in requests per minute; 0 or omitted uses the server default.
+	RateLimit int `json:"rate_limit" validate:"min=0"`
+}
+
+// @Summary      Create an API key
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        body  body  CreateApiKeyRequest  true  "Key settings"
+// @Success      201  {object}  ApiKeyResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse  "Email not verified or scope exceeded"
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/apikeys [post]
+func CreateApiKeyHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	req := new(CreateApiKeyRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "expires_at must be in the future")
+	}
+
+	if scope := callerKeyScope(c); scope != nil && !utils.ScopeCovers(*scope, strings.Fields(req.Scope)...) {
+		return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Requested scope exceeds the API key's scope")
+	}
+
+	tenantID, _ := c.Locals("tenantID").(uint)
+	rawKey, apiKey, err := services.CreateApiKey(c.UserContext(), userID, tenantID, req.Client, req.Scope, req.ExpiresAt, req.RateLimit)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to create API key")
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditApiKeyCreate,
+		Target:   fmt.Sprintf("api_key:%d", apiKey.ID),
+		Metadata: map[string]any{"client": apiKey.Client, "scope": apiKey.Scope},
+	})
+
+	// The raw key is never stored, so this is the only time the client sees it.
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "API key created successfully",
+		"key":     rawKey,
+		"api_key": apiKey,
+	})
+}
+
+// ListApiKeysHandler lists the caller's keys by prefix; the full keys are never
+// stored. Admins can pass user_id to list another user's keys in their tenant.
+//
+// @Summary      List API keys
+// @Tags         api-keys
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        user_id  query  int   false  "Owner (admins only; defaults to the caller)"
+// @Param        active   query  bool  false  "Only keys that are not revoked"
+// @Success      200  {object}  ApiKeyListResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/apikeys [get]
+func ListApiKeysHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	ownerID := userID
+	if c.Query("user_id") != "" {
+		id := c.QueryInt("user_id", 0)
+		if id <= 0 {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid user id")
+		}
+		if uint(id) != userID && c.Locals("role") != "admin" {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Insufficient permissions")
+		}
+		ownerID = uint(id)
+	}
+
+	tenantID, _ := c.Locals("tenantID").(uint)
+	apiKeys, err := services.ListApiKeys(c.UserContext(), ownerID, tenantID, c.QueryBool("active", false))
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to list API keys")
+	}
+
+	return c.JSON(fiber.Map{
+		"api_keys": apiKeys,
+	})
+}
+
+// @Summary      Revoke an API key
+// @Tags         api-keys
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        id  path  int  true  "API key id"
+// @Success      200 {object}  MessageResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/apikeys/{id} [delete]
+func RevokeApiKeyHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid API key id")
+	}
+
+	tenantID, _ := c.Locals("tenantID").(uint)
+	isAdmin := c.Locals("role") == "admin"
+	if err := services.RevokeApiKey(c.UserContext(), uint(id), userID, tenantID, isAdmin); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResponse(c, fiber.StatusNotFound, utils.CodeNotFound, "API key not found")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke API key")
+	}
+
+	audit(c, services.AuditEvent{Action: services.AuditApiKeyRevoke, Target: fmt.Sprintf("api_key:%d", id)})
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
+
+// @Summary      Rotate an API key
+// @Tags         api-keys
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        id  path  int  true  "API key id"
+// @Success      200 {object}  ApiKeyResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse  "Email not verified or scope exceeded"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/apikeys/{id}/rotate [post]
+func RotateApiKeyHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid API key id")
+	}
+
+	tenantID, _ := c.Locals("tenantID").(uint)
+	isAdmin := c.Locals("role") == "admin"
+	rawKey, apiKey, err := services.RotateApiKey(c.UserContext(), uint(id), userID, tenantID, isAdmin, callerKeyScope(c))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResponse(c, fiber.StatusNotFound, utils.CodeNotFound, "API key not found")
+		}
+		if errors.Is(err, services.ErrScopeExceeded) {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "API key scope is wider than the caller's")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to rotate API key")
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditApiKeyRotate,
+		Target:   fmt.Sprintf("api_key:%d", id),
+		Metadata: map[string]any{"new_api_key_id": apiKey.ID},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "API key rotated successfully",
+		"key":     rawKey,
+		"api_key": apiKey,
+	})
+}
+
+// callerKeyScope returns the scope of the API key that authenticated the
+// request, or nil for a JWT.
+func callerKeyScope(c *fiber.Ctx) *string {
+	if c.Locals("authType") != "APIKey" {
+		return nil
+	}
+	scope, _ := c.Locals("scope").(string)
+	return &scope
+}
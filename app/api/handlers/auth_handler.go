@@ -1,80 +1,578 @@
 package handlers
 
 import (
-	"jwt-poc/config"
+	"errors"
+	"fmt"
 	"jwt-poc/models"
 	"jwt-poc/services"
 	"jwt-poc/utils"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required"`
+	Username   string `json:"username" validate:"required,max=64"`
+	Password   string `json:"password" validate:"required,maxbytes=72"`
+	TenantID   uint   `json:"tenant_id"`
+	UseCookies bool   `json:"use_cookies"`
+	// Client, when set, must be listed in JWT_CLIENT_AUDIENCES and selects the
+	// audience of the issued access tokens.
+	Client string `json:"client" validate:"max=64"`
 }
 
+// @Summary      Log in with username and password
+// @Description  Set use_cookies to receive the tokens as HttpOnly cookies instead of in the body.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  LoginRequest  true  "Credentials"
+// @Success      200  {object}  TokenResponse  "Tokens, or a TwoFactorChallengeResponse when TOTP is enabled"
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse  "Email not verified or account deactivated"
+// @Failure      422  {object}  ErrorResponse
+// @Failure      423  {object}  ErrorResponse  "Account locked"
+// @Failure      429  {object}  ErrorResponse
+// @Router       /api/auth/login [post]
 func LoginHandler(c *fiber.Ctx) error {
 	req := new(LoginRequest)
 	if err := c.BodyParser(req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request payload",
-		})
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	if _, err := utils.ClientAudience(req.Client); err != nil {
+		if errors.Is(err, utils.ErrUnknownClient) {
+			return utils.FieldErrorResponse(c, fiber.StatusBadRequest, utils.CodeValidationFailed,
+				"client is not a configured client", map[string]string{"client": "unknown"})
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
 	}
 
-	var user models.User
-	if err := config.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+	user, err := services.Users.FindByUsername(c.UserContext(), req.Username, req.TenantID)
+	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid username or password",
-			})
+			// Burn the same bcrypt time as a wrong password so unknown usernames
+			// can't be told apart by response latency.
+			utils.DummyPasswordCheck(req.Password)
+			utils.LoginTotal.WithLabelValues("failure").Inc()
+			auditLoginFailure(c, 0, req.TenantID, req.Username, "unknown_user")
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid username or password")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Internal server error",
-		})
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	if services.IsAccountLocked(user) {
+		utils.LoginTotal.WithLabelValues("failure").Inc()
+		auditLoginFailure(c, user.ID, user.TenantID, user.Username, "account_locked")
+		return utils.ErrorResponse(c, fiber.StatusLocked, utils.CodeAccountLocked, "Account is temporarily locked, please try again later")
 	}
 
 	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid username or password",
+		if err := services.RecordFailedLogin(c.UserContext(), &user); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+		}
+		utils.LoginTotal.WithLabelValues("failure").Inc()
+		auditLoginFailure(c, user.ID, user.TenantID, user.Username, "invalid_password")
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid username or password")
+	}
+
+	if err := services.ResetFailedLogins(c.UserContext(), &user); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	if !user.IsActive {
+		return rejectInactiveUser(c, user)
+	}
+
+	services.RehashPasswordIfNeeded(c.UserContext(), &user, req.Password)
+
+	if services.EmailVerificationRequired() && !user.EmailVerified {
+		utils.LoginTotal.WithLabelValues("failure").Inc()
+		auditLoginFailure(c, user.ID, user.TenantID, user.Username, "email_not_verified")
+		return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeEmailNotVerified, "Email address is not verified")
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := services.CreateTwoFactorChallenge(c.UserContext(), user, req.Client)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+		}
+		return c.JSON(fiber.Map{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
 		})
 	}
 
-	accessToken, refreshToken, err := services.GenerateAuthToken(user)
+	return loginResponse(c, user, req.Client, req.UseCookies)
+}
+
+// rejectInactiveUser answers a login with the right credentials for a
+// deactivated account.
+func rejectInactiveUser(c *fiber.Ctx, user models.User) error {
+	utils.LoginTotal.WithLabelValues("failure").Inc()
+	auditLoginFailure(c, user.ID, user.TenantID, user.Username, "account_inactive")
+	return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeAccountInactive, "Account is deactivated")
+}
+
+// loginResponse issues tokens for an authenticated user, optionally also
+// setting the access token cookie. Only here does a login count as a success,
+// so one that stops at the 2FA step isn't counted.
+func loginResponse(c *fiber.Ctx, user models.User, client string, useCookies bool) error {
+	tokens, err := services.GenerateAuthToken(c.UserContext(), user, client, deviceLabel(c), clientFingerprint(c))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate tokens",
-		})
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to generate tokens")
 	}
+	utils.LoginTotal.WithLabelValues("success").Inc()
 
-	return c.JSON(fiber.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-		"token_type":    "Bearer",
-		"expires_in":    15 * 60,
+	audit(c, services.AuditEvent{
+		Action:   services.AuditLoginSuccess,
+		ActorID:  user.ID,
+		TenantID: user.TenantID,
+		Target:   fmt.Sprintf("user:%d", user.ID),
+		Metadata: map[string]any{"device": deviceLabel(c), "two_factor": user.TOTPEnabled},
 	})
+
+	if useCookies || c.QueryBool("use_cookies") {
+		setAuthCookies(c, tokens)
+		return c.JSON(tokenResponse(tokens, false))
+	}
+
+	return c.JSON(tokenResponse(tokens, true))
+}
+
+// tokenResponse keeps expires_in for older clients; the absolute expiry times
+// don't drift when a client is suspended.
+func tokenResponse(tokens services.AuthTokens, includeRefreshToken bool) fiber.Map {
+	body := fiber.Map{
+		"access_token":             tokens.AccessToken,
+		"token_type":               "Bearer",
+		"expires_in":               int(utils.AccessTokenTTL.Seconds()),
+		"access_token_expires_at":  tokens.AccessTokenExpiresAt.UTC().Format(time.RFC3339),
+		"refresh_token_expires_at": tokens.RefreshTokenExpiresAt.UTC().Format(time.RFC3339),
+		"active_sessions":          tokens.ActiveSessions,
+	}
+	if includeRefreshToken {
+		body["refresh_token"] = tokens.RefreshToken
+	}
+	return body
 }
 
+func auditLoginFailure(c *fiber.Ctx, userID, tenantID uint, username, reason string) {
+	audit(c, services.AuditEvent{
+		Action:   services.AuditLoginFailure,
+		ActorID:  userID,
+		TenantID: tenantID,
+		Target:   "username:" + username,
+		Metadata: map[string]any{"reason": reason},
+	})
+}
+
+// setAuthCookies stores both tokens in HttpOnly cookies. Cookie clients never
+// get the refresh token in a response body.
+func setAuthCookies(c *fiber.Ctx, tokens services.AuthTokens) {
+	c.Cookie(utils.NewAuthCookie(utils.AccessTokenCookieName(), tokens.AccessToken, tokens.AccessTokenExpiresAt))
+	c.Cookie(utils.NewRefreshTokenCookie(tokens.RefreshToken, tokens.RefreshTokenExpiresAt))
+}
+
+func clearAuthCookies(c *fiber.Ctx) {
+	expired := time.Unix(0, 0)
+	c.Cookie(utils.NewAuthCookie(utils.AccessTokenCookieName(), "", expired))
+	c.Cookie(utils.NewRefreshTokenCookie("", expired))
+}
+
+// RefreshTokenRequest is accepted as JSON or as a form-encoded body.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+func refreshTokenFromRequest(c *fiber.Ctx) (string, error) {
+	if len(c.Body()) == 0 {
+		return "", nil
+	}
+
+	req := new(RefreshTokenRequest)
+	if err := c.BodyParser(req); err != nil {
+		return "", err
+	}
+	return req.RefreshToken, nil
+}
+
+// RefreshTokenHandler prefers the refresh token cookie and answers cookie
+// clients with rotated cookies; otherwise the token comes from the body.
+//
+// @Summary      Rotate a refresh token
+// @Description  The refresh token cookie takes precedence over the body. Presenting an already rotated token revokes all of the user's sessions.
+// @Tags         auth
+// @Accept       json,x-www-form-urlencoded
+// @Produce      json
+// @Param        body  body  RefreshTokenRequest  false  "Refresh token, unless sent as a cookie"
+// @Success      200  {object}  TokenResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse  "Account deactivated"
+// @Router       /api/auth/refresh [post]
 func RefreshTokenHandler(c *fiber.Ctx) error {
-	refreshToken := c.FormValue("refresh_token")
+	refreshToken := c.Cookies(utils.RefreshTokenCookieName())
+	fromCookie := refreshToken != ""
+	if !fromCookie {
+		var err error
+		refreshToken, err = refreshTokenFromRequest(c)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+		}
+	}
 	if refreshToken == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Missing refresh token",
-		})
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Missing refresh token")
 	}
 
-	accessToken, newRefreshToken, err := services.RefreshAndRevokeToken(refreshToken)
+	tokens, err := services.RefreshAndRevokeToken(c.UserContext(), refreshToken, clientFingerprint(c))
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid or expired refresh token",
-		})
+		utils.RefreshTotal.WithLabelValues("failure").Inc()
+	}
+	if errors.Is(err, services.ErrTokenReuse) {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "token reuse detected")
+	}
+	if errors.Is(err, services.ErrRefreshTokenRevoked) {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Refresh token has been revoked")
+	}
+	if errors.Is(err, services.ErrFingerprintMismatch) {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Refresh token was issued to a different client")
+	}
+	if errors.Is(err, services.ErrUserInactive) {
+		return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeAccountInactive, "Account is deactivated")
+	}
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid or expired refresh token")
+	}
+
+	utils.RefreshTotal.WithLabelValues("success").Inc()
+
+	if fromCookie {
+		setAuthCookies(c, tokens)
+		return c.JSON(tokenResponse(tokens, false))
+	}
+
+	return c.JSON(tokenResponse(tokens, true))
+}
+
+// @Summary      Revoke a refresh token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  RefreshTokenRequest  false  "Refresh token, unless sent as a cookie"
+// @Success      204
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/auth/logout [post]
+func LogoutHandler(c *fiber.Ctx) error {
+	refreshToken := c.Cookies(utils.RefreshTokenCookieName())
+	if refreshToken == "" {
+		var err error
+		refreshToken, err = refreshTokenFromRequest(c)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+		}
+	}
+	if refreshToken == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Missing refresh token")
+	}
+
+	// Logout needs no access token, so the actor comes from the refresh token.
+	sessionUserID, sessionTarget, findErr := services.RefreshTokenSession(c.UserContext(), refreshToken)
+
+	// Unknown tokens are not an error so clients can safely retry a logout.
+	if err := services.RevokeRefreshToken(c.UserContext(), refreshToken); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke refresh token")
+	}
+
+	if findErr == nil {
+		event := services.AuditEvent{Action: services.AuditLogout, ActorID: sessionUserID, Target: sessionTarget}
+		if user, err := services.FindUserByID(c.UserContext(), sessionUserID); err == nil {
+			event.TenantID = user.TenantID
+		}
+		audit(c, event)
+	}
+
+	clearAuthCookies(c)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary      Revoke all sessions of the caller
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  RevokedResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/auth/logout-all [post]
+func LogoutAllHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	revoked, err := services.RevokeAllUserTokens(c.UserContext(), userID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke refresh tokens")
+	}
+
+	// Also kill the access token used for this request.
+	if claims, err := utils.GetClaims(c); err == nil && claims.ExpiresAt != nil {
+		if err := services.BlacklistToken(c.UserContext(), claims.ID, claims.ExpiresAt.Time); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke access token")
+		}
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditLogout,
+		Target:   fmt.Sprintf("user:%d", userID),
+		Metadata: map[string]any{"all_sessions": true, "revoked_sessions": revoked},
+	})
+
+	return c.JSON(fiber.Map{
+		"revoked": revoked,
+	})
+}
+
+// @Summary      Verify an email address
+// @Tags         auth
+// @Produce      json
+// @Param        token  query  string  true  "Verification token"
+// @Success      200  {object}  MessageResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse  "New email taken since the change was requested"
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/auth/verify [get]
+func VerifyEmailHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Missing verification token")
+	}
+
+	if err := services.VerifyEmail(c.UserContext(), token); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidVerificationToken):
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid or expired verification token")
+		case errors.Is(err, services.ErrEmailExists):
+			return utils.FieldErrorResponse(c, fiber.StatusConflict, utils.CodeConflict, "email already registered", map[string]string{"email": "already registered"})
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to verify email")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// MeHandler works for both auth types: API keys resolve to their owning user.
+//
+// @Summary      Current user
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  MeResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /api/auth/me [get]
+func MeHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	user, err := services.FindUserByID(c.UserContext(), userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResponse(c, fiber.StatusNotFound, utils.CodeNotFound, "User not found")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	grants, err := services.ListUserPermissions(c.UserContext(), user.ID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	me := fiber.Map{
+		"id":             user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"tenant_id":      user.TenantID,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+		"permissions":    services.EffectivePermissions(user.Role, grants),
+	}
+	if actorID, ok := c.Locals("actorID").(uint); ok {
+		me["impersonated_by"] = actorID
+	}
+	return c.JSON(me)
+}
+
+// ValidateTokenHandler is a forward-auth target for reverse proxies (nginx
+// auth_request, Traefik forwardAuth). AuthMiddleware has already answered 401
+// for bad credentials; here the identity is echoed in X-User-Id, X-Tenant-Id
+// and X-Auth-Type for the proxy to pass on to backends, plus X-User-Role for
+// JWTs or X-Auth-Scope for API keys. A key is only as strong as its scope, so
+// the owner's role is never sent for it.
+//
+// @Summary      Validate credentials for a reverse proxy
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  ValidateResponse
+// @Header       200  {string}  X-User-Id    "Authenticated user"
+// @Header       200  {string}  X-User-Role   "Role in the JWT"
+// @Header       200  {string}  X-Auth-Scope  "Scope of the API key"
+// @Header       200  {string}  X-Tenant-Id   "Tenant of the user"
+// @Header       200  {string}  X-Auth-Type   "JWT or APIKey"
+// @Failure      401  {object}  ErrorResponse
+// @Router       /api/auth/validate [get]
+func ValidateTokenHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+	tenantID, _ := c.Locals("tenantID").(uint)
+	authType, _ := c.Locals("authType").(string)
+
+	c.Set("X-User-Id", strconv.FormatUint(uint64(userID), 10))
+	c.Set("X-Tenant-Id", strconv.FormatUint(uint64(tenantID), 10))
+	c.Set("X-Auth-Type", authType)
+	identity := fiber.Map{
+		"user_id":   userID,
+		"tenant_id": tenantID,
+		"auth_type": authType,
+	}
+	if authType == "APIKey" {
+		scope, _ := c.Locals("scope").(string)
+		c.Set("X-Auth-Scope", scope)
+		identity["scope"] = scope
+	} else {
+		role, _ := c.Locals("role").(string)
+		c.Set("X-User-Role", role)
+		identity["role"] = role
+	}
+	return c.JSON(identity)
+}
+
+// clientFingerprint is what refresh tokens are bound to; see
+// REFRESH_TOKEN_BINDING.
+func clientFingerprint(c *fiber.Ctx) utils.ClientFingerprint {
+	return utils.NewClientFingerprint(c.Get(fiber.HeaderUserAgent), c.IP())
+}
+
+// deviceLabel names a session after the client's User-Agent.
+func deviceLabel(c *fiber.Ctx) string {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	return userAgent
+}
+
+// @Summary      List active sessions
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  SessionsResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/auth/sessions [get]
+func ListSessionsHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	sessions, err := services.ListActiveSessions(c.UserContext(), userID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to list sessions")
 	}
 
 	return c.JSON(fiber.Map{
-		"access_token":  accessToken,
-		"refresh_token": newRefreshToken,
-		"token_type":    "Bearer",
-		"expires_in":    15 * 60,
+		"sessions": sessions,
 	})
 }
+
+// @Summary      Revoke one session
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        id  path  int  true  "Session id"
+// @Success      204
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /api/auth/sessions/{id} [delete]
+func RevokeSessionHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid session id")
+	}
+
+	if err := services.RevokeSession(c.UserContext(), userID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResponse(c, fiber.StatusNotFound, utils.CodeNotFound, "Session not found")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke session")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AdminRevokeTokenHandler deletes any refresh token of the admin's tenant, for
+// killing a leaked session. Access tokens already issued from it stay valid
+// until they expire.
+//
+// @Summary      Revoke a refresh token as an admin
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Refresh token (session) id"
+// @Success      204
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/admin/tokens/{id} [delete]
+func AdminRevokeTokenHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid token id")
+	}
+
+	tenantID, _ := c.Locals("tenantID").(uint)
+	token, err := services.ForceRevokeRefreshToken(c.UserContext(), uint(id), tenantID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResponse(c, fiber.StatusNotFound, utils.CodeNotFound, "Refresh token not found")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke refresh token")
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditRefreshTokenRevoke,
+		Target:   fmt.Sprintf("user:%d", token.UserID),
+		Metadata: map[string]any{"session_id": token.ID, "device": token.Device},
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
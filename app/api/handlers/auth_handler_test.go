@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"jwt-poc/internal/testdb"
+	"jwt-poc/middlewares"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newAuthTestApp() *fiber.App {
+	app := fiber.New()
+	app.Post("/login", LoginHandler)
+	app.Post("/refresh", RefreshTokenHandler)
+	app.Get("/profile", middlewares.AuthMiddleware(middlewares.WithFreshUserCheck()), ProfileHandler)
+	return app
+}
+
+// doJSON sends body as JSON and decodes the response into a map.
+func doJSON(t *testing.T, app *fiber.App, method, path string, body any, header map[string]string) (int, map[string]any) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	decoded := map[string]any{}
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func login(t *testing.T, app *fiber.App, username string) (int, map[string]any) {
+	t.Helper()
+	return doJSON(t, app, fiber.MethodPost, "/login", fiber.Map{"username": username, "password": testdb.Password}, nil)
+}
+
+func TestSoftDeletedUserIsRejected(t *testing.T) {
+	testdb.Open(t)
+	app := newAuthTestApp()
+	user := testdb.CreateUser(t, "alice")
+
+	status, tokens := login(t, app, "alice")
+	if status != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", status, http.StatusOK)
+	}
+	accessToken, _ := tokens["access_token"].(string)
+	refreshToken, _ := tokens["refresh_token"].(string)
+	bearer := map[string]string{fiber.HeaderAuthorization: "Bearer " + accessToken}
+
+	if status, _ := doJSON(t, app, fiber.MethodGet, "/profile", nil, bearer); status != http.StatusOK {
+		t.Fatalf("/profile before delete = %d, want %d", status, http.StatusOK)
+	}
+
+	if err := services.DeleteUser(context.Background(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := login(t, app, "alice"); status != http.StatusUnauthorized {
+		t.Errorf("login after delete = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := doJSON(t, app, fiber.MethodPost, "/refresh", fiber.Map{"refresh_token": refreshToken}, nil); status != http.StatusUnauthorized {
+		t.Errorf("refresh after delete = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := doJSON(t, app, fiber.MethodGet, "/profile", nil, bearer); status != http.StatusUnauthorized {
+		t.Errorf("/profile after delete = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginRehashesOutdatedPassword(t *testing.T) {
+	testdb.Open(t)
+	app := newAuthTestApp()
+	user := testdb.CreateUser(t, "alice")
+
+	utils.SetBcryptCost(bcrypt.MinCost + 1)
+	t.Cleanup(func() { utils.SetBcryptCost(bcrypt.MinCost) })
+
+	storedCost := func() int {
+		t.Helper()
+		stored, err := services.FindUserByID(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cost, err := bcrypt.Cost([]byte(stored.PasswordHash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cost
+	}
+
+	status, _ := doJSON(t, app, fiber.MethodPost, "/login", fiber.Map{"username": "alice", "password": "wrong password"}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if cost := storedCost(); cost != bcrypt.MinCost {
+		t.Fatalf("cost after failed login = %d, want %d", cost, bcrypt.MinCost)
+	}
+
+	if status, _ := login(t, app, "alice"); status != http.StatusOK {
+		t.Fatalf("login = %d, want %d", status, http.StatusOK)
+	}
+	if cost := storedCost(); cost != bcrypt.MinCost+1 {
+		t.Errorf("cost after login = %d, want %d", cost, bcrypt.MinCost+1)
+	}
+	if status, _ := login(t, app, "alice"); status != http.StatusOK {
+		t.Errorf("login with rehashed password = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestValidateTokenHandlerHeaders(t *testing.T) {
+	testdb.Open(t)
+	app := newAuthTestApp()
+	app.Get("/validate", middlewares.AuthMiddleware(), ValidateTokenHandler)
+	user := testdb.CreateUser(t, "alice")
+
+	_, tokens := login(t, app, "alice")
+	accessToken, _ := tokens["access_token"].(string)
+	rawKey, _, err := services.CreateApiKey(context.Background(), user.ID, user.TenantID, "cli", "apikeys:read", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		wantRole  string
+		wantScope string
+	}{
+		{"jwt", fiber.HeaderAuthorization, "Bearer " + accessToken, "user", ""},
+		{"api key", "api-key", rawKey, "", "apikeys:read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/validate", nil)
+			req.Header.Set(tt.header, tt.value)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			if got := resp.Header.Get("X-User-Role"); got != tt.wantRole {
+				t.Errorf("X-User-Role = %q, want %q", got, tt.wantRole)
+			}
+			if got := resp.Header.Get("X-Auth-Scope"); got != tt.wantScope {
+				t.Errorf("X-Auth-Scope = %q, want %q", got, tt.wantScope)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"jwt-poc/models"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Statuses of a row in a bulk import.
+const (
+	bulkStatusCreated     = "created"
+	bulkStatusInvalid     = "invalid"
+	bulkStatusConflict    = "conflict"
+	bulkStatusNotImported = "not_imported"
+)
+
+var bulkImportMaxUsers = 100
+
+// SetBulkImportMaxUsers applies BULK_IMPORT_MAX_USERS once at startup;
+// config.Load has already checked it.
+func SetBulkImportMaxUsers(max int) {
+	bulkImportMaxUsers = max
+}
+
+type BulkUserResult struct {
+	Index    int               `json:"index"`
+	Username string            `json:"username"`
+	Status   string            `json:"status" enums:"created,invalid,conflict,not_imported"`
+	Error    string            `json:"error,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	User     *models.User      `json:"user,omitempty"`
+}
+
+type BulkUserResponse struct {
+	Created int              `json:"created"`
+	Results []BulkUserResult `json:"results"`
+}
+
+// BulkCreateUsersHandler imports all rows or none. Every row is validated and
+// checked for conflicts first, so one response lists all the problems; rows
+// without a problem then report not_imported. Users are created in the
+// caller's tenant.
+//
+// @Summary      Import users in bulk
+// @Description  All rows are created in one transaction, or none is. The batch size is capped by BULK_IMPORT_MAX_USERS (100 by default).
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        body  body  []CreateUserRequest  true  "Users to create"
+// @Success      201  {object}  BulkUserResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      409  {object}  BulkUserResponse  "A username or email is taken"
+// @Failure      422  {object}  BulkUserResponse  "A row failed validation"
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/user/bulk [post]
+func BulkCreateUsersHandler(c *fiber.Ctx) error {
+	var rows []CreateUserRequest
+	if err := c.BodyParser(&rows); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if len(rows) == 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "No users to import")
+	}
+	if len(rows) > bulkImportMaxUsers {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, fmt.Sprintf("At most %d users can be imported at once", bulkImportMaxUsers))
+	}
+
+	if c.Locals("role") != "admin" {
+		for _, row := range rows {
+			if row.Role == "admin" {
+				return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Only admins can create admins")
+			}
+		}
+	}
+
+	results := make([]BulkUserResult, len(rows))
+	usernames := make([]string, len(rows))
+	emails := make([]string, len(rows))
+	for i, row := range rows {
+		results[i] = BulkUserResult{Index: i, Username: row.Username, Status: bulkStatusNotImported}
+		usernames[i] = row.Username
+		emails[i] = row.Email
+	}
+
+	invalid := false
+	for i, row := range rows {
+		if err := utils.ValidateStruct(row); err != nil {
+			var validationErr *utils.ValidationError
+			if errors.As(err, &validationErr) {
+				results[i].Fields = validationErr.Fields
+			}
+			results[i].Status, results[i].Error = bulkStatusInvalid, "validation failed"
+			invalid = true
+			continue
+		}
+
+		var policyErr *utils.PasswordPolicyError
+		if err := utils.ValidatePasswordStrength(row.Password); errors.As(err, &policyErr) {
+			results[i].Fields = map[string]string{"password": policyErr.Rule}
+			results[i].Status, results[i].Error = bulkStatusInvalid, policyErr.Message
+			invalid = true
+		}
+	}
+	if invalid {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(BulkUserResponse{Results: results})
+	}
+
+	tenantID, _ := c.Locals("tenantID").(uint)
+	takenUsernames, takenEmails, err := services.TakenUsernamesAndEmails(c.UserContext(), tenantID, usernames, emails)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to import users")
+	}
+	conflict := false
+	for i, row := range rows {
+		switch {
+		case takenUsernames[row.Username]:
+			results[i].Status, results[i].Error = bulkStatusConflict, services.ErrUsernameExists.Error()
+		case takenEmails[row.Email]:
+			results[i].Status, results[i].Error = bulkStatusConflict, services.ErrEmailExists.Error()
+		default:
+			// Later rows repeating an earlier row of the same batch.
+			takenUsernames[row.Username], takenEmails[row.Email] = true, true
+			continue
+		}
+		conflict = true
+	}
+	if conflict {
+		return c.Status(fiber.StatusConflict).JSON(BulkUserResponse{Results: results})
+	}
+
+	users := make([]models.User, len(rows))
+	for i, row := range rows {
+		hashedPassword, err := utils.HashPassword(row.Password)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to hash password")
+		}
+		users[i] = models.User{
+			Username:     row.Username,
+			PasswordHash: hashedPassword,
+			Email:        row.Email,
+			Role:         row.Role,
+			TenantID:     tenantID,
+		}
+	}
+
+	if err := services.BulkCreateUsers(c.UserContext(), users); err != nil {
+		// Lost a race with another registration after the conflict check.
+		var insertErr *services.BulkInsertError
+		if errors.As(err, &insertErr) && (errors.Is(err, services.ErrUsernameExists) || errors.Is(err, services.ErrEmailExists)) {
+			results[insertErr.Index].Status, results[insertErr.Index].Error = bulkStatusConflict, insertErr.Err.Error()
+			return c.Status(fiber.StatusConflict).JSON(BulkUserResponse{Results: results})
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to import users")
+	}
+
+	for i := range users {
+		results[i].Status, results[i].User = bulkStatusCreated, &users[i]
+		if err := services.SendVerificationEmail(c.UserContext(), users[i]); err != nil {
+			log.Println("failed to send verification email:", err)
+		}
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditUserBulkImport,
+		Target:   fmt.Sprintf("tenant:%d", tenantID),
+		Metadata: map[string]any{"created": len(users)},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(BulkUserResponse{Created: len(users), Results: results})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DecodeTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// DecodeTokenHandler shows what is inside a token and whether this service
+// would accept it, without requiring it to be valid. It is only registered
+// with DEBUG_ENDPOINTS=true.
+//
+// @Summary      Decode a JWT for debugging
+// @Description  Only available with DEBUG_ENDPOINTS=true. Claims are shown as encoded, so compact tokens keep their short names.
+// @Tags         debug
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  DecodeTokenRequest  true  "Token to decode"
+// @Success      200  {object}  utils.JWTInspection
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Router       /api/debug/decode [post]
+func DecodeTokenHandler(c *fiber.Ctx) error {
+	req := new(DecodeTokenRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	inspection, err := utils.InspectJWT(req.Token)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeTokenMalformed, "Token cannot be decoded: "+err.Error())
+	}
+	return c.JSON(inspection)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"jwt-poc/config"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Summary      Liveness probe
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  HealthResponse
+// @Router       /healthz [get]
+func HealthzHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// @Summary      Readiness probe
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  ReadyResponse
+// @Failure      503  {object}  ReadyResponse
+// @Router       /readyz [get]
+func ReadyzHandler(c *fiber.Ctx) error {
+	sqlDB, err := config.DB.DB()
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unavailable",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	latency := time.Since(start)
+
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":        "unavailable",
+			"db_latency_ms": latency.Milliseconds(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":        "ok",
+		"db_latency_ms": latency.Milliseconds(),
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImpersonateRequest struct {
+	// Reason is kept in the audit log.
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// ImpersonateUserHandler issues the admin an access token acting as the user,
+// for IMPERSONATION_TOKEN_TTL and without a refresh token. The token's act
+// claim names the admin, and audit events produced with it record the admin as
+// impersonator_id. While impersonating, the user's password, email, 2FA, API
+// keys and sessions can't be changed.
+//
+// @Summary      Impersonate a user
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int                 true  "User id"
+// @Param        body  body  ImpersonateRequest  true  "Why the user is impersonated"
+// @Success      200  {object}  ImpersonationResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/admin/impersonate/{id} [post]
+func ImpersonateUserHandler(c *fiber.Ctx) error {
+	req := new(ImpersonateRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	user, err := tenantUserFromParams(c)
+	if user == nil {
+		return err
+	}
+
+	actorID, _ := c.Locals("userID").(uint)
+	accessToken, expiresAt, err := services.Impersonate(*user, actorID)
+	switch {
+	case errors.Is(err, services.ErrImpersonateSelf):
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "You cannot impersonate yourself")
+	case errors.Is(err, services.ErrImpersonateAdmin):
+		return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Admins cannot be impersonated")
+	case errors.Is(err, services.ErrUserInactive):
+		return utils.ErrorResponse(c, fiber.StatusConflict, utils.CodeConflict, "User is deactivated")
+	case err != nil:
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to issue impersonation token")
+	}
+
+	audit(c, services.AuditEvent{
+		Action: services.AuditUserImpersonate,
+		Target: fmt.Sprintf("user:%d", user.ID),
+		Metadata: map[string]any{
+			"reason":     req.Reason,
+			"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"access_token":            accessToken,
+		"token_type":              "Bearer",
+		"expires_in":              int(time.Until(expiresAt).Seconds()),
+		"access_token_expires_at": expiresAt.UTC().Format(time.RFC3339),
+		"user":                    user,
+	})
+}
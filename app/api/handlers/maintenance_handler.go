@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"jwt-poc/services"
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MaintenanceRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// @Summary      Maintenance mode state
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  MaintenanceResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Router       /api/admin/maintenance [get]
+func GetMaintenanceHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"enabled": utils.MaintenanceMode()})
+}
+
+// SetMaintenanceHandler switches read-only maintenance mode on or off for this
+// instance until the next restart, which goes back to MAINTENANCE_MODE.
+//
+// @Summary      Switch maintenance mode
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        body  body  MaintenanceRequest  true  "New state"
+// @Success      200  {object}  MaintenanceResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Router       /api/admin/maintenance [put]
+func SetMaintenanceHandler(c *fiber.Ctx) error {
+	req := new(MaintenanceRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	previous := utils.MaintenanceMode()
+	utils.SetMaintenanceMode(*req.Enabled)
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditMaintenanceToggle,
+		Target:   "maintenance",
+		Metadata: map[string]any{"from": previous, "to": *req.Enabled},
+	})
+
+	return c.JSON(fiber.Map{"enabled": *req.Enabled})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// NotificationSocketHandler keeps the socket registered for services.Notify
+// until the client disconnects. Messages from the client are read and
+// dropped. The socket is closed when the access token expires, after which the
+// client reconnects with a fresh one.
+//
+// @Summary      Notification WebSocket
+// @Description  Upgrades to a WebSocket that receives the caller's notifications as JSON messages. Browsers pass the JWT as the access_token query parameter or as the subprotocols ["access_token", "<jwt>"].
+// @Tags         notifications
+// @Param        access_token  query  string  false  "JWT, when not sent as a subprotocol"
+// @Success      101
+// @Failure      401  {object}  ErrorResponse
+// @Failure      426  {object}  ErrorResponse
+// @Router       /api/ws [get]
+func NotificationSocketHandler(conn *websocket.Conn) {
+	userID, _ := conn.Locals("userID").(uint)
+	unregister := services.RegisterSocket(userID, conn)
+	defer unregister()
+
+	if claims, ok := conn.Locals(utils.ClaimsLocalsKey).(*utils.Claims); ok && claims.ExpiresAt != nil {
+		expiry := time.AfterFunc(time.Until(claims.ExpiresAt.Time), func() {
+			message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired")
+			_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+			conn.Close()
+		})
+		defer expiry.Stop()
+	}
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"jwt-poc/models"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type GrantPermissionRequest struct {
+	Permission string `json:"permission" validate:"required,max=100"`
+}
+
+// @Summary      List a user's permissions
+// @Description  permissions is the union of the role's permissions (ROLE_PERMISSIONS) and granted, the user's direct grants.
+// @Tags         permissions
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path  int  true  "User id"
+// @Success      200  {object}  PermissionsResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/user/{id}/permissions [get]
+func ListUserPermissionsHandler(c *fiber.Ctx) error {
+	user, err := tenantUserFromParams(c)
+	if user == nil {
+		return err
+	}
+	return permissionsResponse(c, user)
+}
+
+// @Summary      Grant a permission to a user
+// @Tags         permissions
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int                     true  "User id"
+// @Param        body  body  GrantPermissionRequest  true  "Permission, e.g. user:delete"
+// @Success      200  {object}  PermissionsResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/user/{id}/permissions [post]
+func GrantPermissionHandler(c *fiber.Ctx) error {
+	req := new(GrantPermissionRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+	if !utils.ValidPermission(req.Permission) {
+		return utils.FieldErrorResponse(c, fiber.StatusUnprocessableEntity, utils.CodeValidationFailed,
+			"permission must be resource:action", map[string]string{"permission": "permission"})
+	}
+
+	user, err := tenantUserFromParams(c)
+	if user == nil {
+		return err
+	}
+
+	if err := services.GrantPermission(c.UserContext(), user.ID, req.Permission); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to grant permission")
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditPermissionGrant,
+		Target:   fmt.Sprintf("user:%d", user.ID),
+		Metadata: map[string]any{"permission": req.Permission},
+	})
+
+	return permissionsResponse(c, user)
+}
+
+// RevokePermissionHandler removes a direct grant. Permissions that come with
+// the user's role stay.
+//
+// @Summary      Revoke a permission from a user
+// @Tags         permissions
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path  int     true  "User id"
+// @Param        permission  path  string  true  "Permission, e.g. user:delete"
+// @Success      200  {object}  PermissionsResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api/user/{id}/permissions/{permission} [delete]
+func RevokePermissionHandler(c *fiber.Ctx) error {
+	permission, err := url.PathUnescape(c.Params("permission"))
+	if err != nil || !utils.ValidPermission(permission) {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid permission")
+	}
+
+	user, err := tenantUserFromParams(c)
+	if user == nil {
+		return err
+	}
+
+	revoked, err := services.RevokePermission(c.UserContext(), user.ID, permission)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to revoke permission")
+	}
+	if !revoked {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, utils.CodeNotFound, "Permission not granted to this user")
+	}
+
+	audit(c, services.AuditEvent{
+		Action:   services.AuditPermissionRevoke,
+		Target:   fmt.Sprintf("user:%d", user.ID),
+		Metadata: map[string]any{"permission": permission},
+	})
+
+	return permissionsResponse(c, user)
+}
+
+func permissionsResponse(c *fiber.Ctx, user *models.User) error {
+	granted, err := services.ListUserPermissions(c.UserContext(), user.ID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to list permissions")
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id":     user.ID,
+		"role":        user.Role,
+		"permissions": services.EffectivePermissions(user.Role, granted),
+		"granted":     granted,
+	})
+}
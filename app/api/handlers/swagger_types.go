@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"time"
+)
+
+// The handlers build their bodies with fiber.Map; these types only describe
+// those bodies for the swagger annotations.
+
+type ErrorResponse struct {
+	Error utils.ErrorBody `json:"error"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// Left out when the tokens are set as cookies.
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
+	// RFC 3339 timestamps in UTC.
+	AccessTokenExpiresAt  string `json:"access_token_expires_at" example:"2025-01-01T12:15:00Z"`
+	RefreshTokenExpiresAt string `json:"refresh_token_expires_at" example:"2025-01-31T12:00:00Z"`
+	ActiveSessions        int64  `json:"active_sessions"`
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required" example:"true"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type RevokedResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type MeResponse struct {
+	ID            uint   `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	TenantID      uint   `json:"tenant_id"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	// Permissions granted by the role and directly; see PermissionsResponse.
+	Permissions []string `json:"permissions" example:"apikey:create"`
+	// The admin's user id when the token is an impersonation token.
+	ImpersonatedBy uint `json:"impersonated_by,omitempty"`
+}
+
+type MaintenanceResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+type ValidateResponse struct {
+	UserID   uint   `json:"user_id"`
+	TenantID uint   `json:"tenant_id"`
+	Role     string `json:"role,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	AuthType string `json:"auth_type"`
+}
+
+type SessionsResponse struct {
+	Sessions []models.RefreshToken `json:"sessions"`
+}
+
+type UserResponse struct {
+	Message string      `json:"message"`
+	User    models.User `json:"user"`
+}
+
+// ProfileResponse has the JWT fields or the API key fields depending on
+// access_by.
+type ProfileResponse struct {
+	UserID    uint       `json:"user_id"`
+	Role      string     `json:"role"`
+	AccessBy  string     `json:"access_by" enums:"JWT,APIKey"`
+	JTI       string     `json:"jti,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ClientID  string     `json:"client_id,omitempty"`
+}
+
+type ChangePasswordResponse struct {
+	Message         string `json:"message"`
+	RevokedSessions int64  `json:"revoked_sessions"`
+}
+
+type ChangeRoleResponse struct {
+	Message         string      `json:"message"`
+	User            models.User `json:"user"`
+	RevokedSessions int64       `json:"revoked_sessions"`
+}
+
+type DeactivateUserResponse struct {
+	Message         string      `json:"message"`
+	User            models.User `json:"user"`
+	RevokedSessions int64       `json:"revoked_sessions"`
+}
+
+type ImpersonationResponse struct {
+	AccessToken          string      `json:"access_token"`
+	TokenType            string      `json:"token_type" example:"Bearer"`
+	ExpiresIn            int         `json:"expires_in" example:"300"`
+	AccessTokenExpiresAt string      `json:"access_token_expires_at" example:"2025-01-01T12:05:00Z"`
+	User                 models.User `json:"user"`
+}
+
+type PermissionsResponse struct {
+	UserID uint   `json:"user_id"`
+	Role   string `json:"role"`
+	// Permissions is what the user is allowed: Granted plus the role's.
+	Permissions []string `json:"permissions" example:"apikey:create,user:delete"`
+	Granted     []string `json:"granted" example:"user:delete"`
+}
+
+type UserListResponse struct {
+	Data   []models.User `json:"data"`
+	Total  int64         `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+type AuditLogListResponse struct {
+	Data   []models.AuditLog `json:"data"`
+	Total  int64             `json:"total"`
+	Limit  int               `json:"limit"`
+	Offset int               `json:"offset"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code" example:"data:image/png;base64,..."`
+}
+
+// ApiKeyResponse carries the raw key, which is shown only once.
+type ApiKeyResponse struct {
+	Message string        `json:"message"`
+	Key     string        `json:"key"`
+	ApiKey  models.ApiKey `json:"api_key"`
+}
+
+type ApiKeyListResponse struct {
+	ApiKeys []models.ApiKey `json:"api_keys"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status" example:"ok"`
+}
+
+type ReadyResponse struct {
+	Status      string `json:"status" example:"ok"`
+	DBLatencyMs int64  `json:"db_latency_ms"`
+}
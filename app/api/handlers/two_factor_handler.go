@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,len=6,numeric"`
+	UseCookies     bool   `json:"use_cookies"`
+}
+
+// @Summary      Start TOTP enrollment
+// @Tags         two-factor
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  TwoFactorEnrollmentResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Router       /api/user/2fa/enroll [post]
+func EnrollTwoFactorHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	user, err := services.FindUserByID(c.UserContext(), userID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	enrollment, err := services.EnrollTOTP(c.UserContext(), user)
+	if err != nil {
+		if errors.Is(err, services.ErrTOTPAlreadyEnabled) {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Two-factor authentication is already enabled")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to start two-factor enrollment")
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      enrollment.Secret,
+		"otpauth_url": enrollment.URL,
+		"qr_code":     enrollment.QRCode,
+	})
+}
+
+// @Summary      Confirm TOTP enrollment
+// @Tags         two-factor
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        body  body  TwoFactorCodeRequest  true  "Current TOTP code"
+// @Success      200  {object}  MessageResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Router       /api/user/2fa/verify [post]
+func VerifyTwoFactorHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+	}
+
+	req := new(TwoFactorCodeRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	user, err := services.FindUserByID(c.UserContext(), userID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	if err := services.ConfirmTOTP(c.UserContext(), user, req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrTOTPAlreadyEnabled):
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Two-factor authentication is already enabled")
+		case errors.Is(err, services.ErrTOTPNotEnrolled):
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Two-factor enrollment has not been started")
+		case errors.Is(err, services.ErrInvalidTOTPCode):
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid two-factor code")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Failed to enable two-factor authentication")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication enabled",
+	})
+}
+
+// TwoFactorLoginHandler finishes a login that LoginHandler answered with a
+// two-factor challenge.
+//
+// @Summary      Finish a two-factor login
+// @Tags         two-factor
+// @Accept       json
+// @Produce      json
+// @Param        body  body  TwoFactorLoginRequest  true  "Challenge from /api/auth/login and TOTP code"
+// @Success      200  {object}  TokenResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse  "Account deactivated"
+// @Failure      422  {object}  ErrorResponse
+// @Failure      429  {object}  ErrorResponse
+// @Router       /api/auth/2fa [post]
+func TwoFactorLoginHandler(c *fiber.Ctx) error {
+	req := new(TwoFactorLoginRequest)
+	if err := c.BodyParser(req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return validationErrorResponse(c, err)
+	}
+
+	user, client, err := services.CompleteTwoFactorChallenge(c.UserContext(), req.ChallengeToken, req.Code)
+	if err != nil {
+		if user.ID != 0 {
+			utils.LoginTotal.WithLabelValues("failure").Inc()
+			auditLoginFailure(c, user.ID, user.TenantID, user.Username, "invalid_totp_code")
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidTwoFactorChallenge), errors.Is(err, gorm.ErrRecordNotFound):
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid or expired two-factor challenge")
+		case errors.Is(err, services.ErrInvalidTOTPCode):
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid two-factor code")
+		}
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	if !user.IsActive {
+		return rejectInactiveUser(c, user)
+	}
+
+	return loginResponse(c, user, client, req.UseCookies)
+}
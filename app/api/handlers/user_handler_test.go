@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"jwt-poc/internal/testdb"
+	"jwt-poc/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProfileHandlerWithoutAuthLocals(t *testing.T) {
+	tests := []struct {
+		name   string
+		locals map[string]any
+	}{
+		{"no locals", nil},
+		{"authType not a string", map[string]any{"authType": 1}},
+		{"unknown authType", map[string]any{"authType": "Basic"}},
+		{"JWT without claims", map[string]any{"authType": "JWT"}},
+		{"API key without client", map[string]any{"authType": "APIKey"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/profile", func(c *fiber.Ctx) error {
+				for key, value := range tt.locals {
+					c.Locals(key, value)
+				}
+				return c.Next()
+			}, ProfileHandler)
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/profile", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestCreateUserHandlerConflicts(t *testing.T) {
+	testdb.Open(t)
+	app := fiber.New()
+	app.Post("/register", CreateUserHandler)
+	testdb.CreateUser(t, "alice")
+
+	tests := []struct {
+		name        string
+		username    string
+		email       string
+		wantMessage string
+		wantField   string
+	}{
+		{"duplicate username", "alice", "other@example.com", "username already exists", "username"},
+		{"duplicate email", "bob", "alice@example.com", "email already registered", "email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fiber.Map{"username": tt.username, "email": tt.email, "password": testdb.Password, "role": "user"}
+			status, resp := doJSON(t, app, fiber.MethodPost, "/register", body, nil)
+			if status != http.StatusConflict {
+				t.Fatalf("status = %d, want %d", status, http.StatusConflict)
+			}
+
+			errBody, _ := resp["error"].(map[string]any)
+			if message := errBody["message"]; message != tt.wantMessage {
+				t.Errorf("message = %v, want %q", message, tt.wantMessage)
+			}
+			if fields, _ := errBody["fields"].(map[string]any); fields[tt.wantField] == nil {
+				t.Errorf("fields = %v, want an entry for %s", errBody["fields"], tt.wantField)
+			}
+		})
+	}
+}
+
+func TestCreateUserHandlerAllowsNameInOtherTenant(t *testing.T) {
+	testdb.Open(t)
+	app := fiber.New()
+	app.Post("/register", CreateUserHandler)
+	testdb.CreateUser(t, "alice")
+
+	services.SetRegistrationTenant(1)
+	t.Cleanup(func() { services.SetRegistrationTenant(0) })
+
+	body := fiber.Map{"username": "alice", "email": "alice@example.com", "password": testdb.Password, "role": "user"}
+	if status, _ := doJSON(t, app, fiber.MethodPost, "/register", body, nil); status != http.StatusCreated {
+		t.Errorf("status = %d, want %d", status, http.StatusCreated)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"errors"
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func validationErrorResponse(c *fiber.Ctx, err error) error {
+	var validationErr *utils.ValidationError
+	if !errors.As(err, &validationErr) {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeInvalidPayload, "Invalid request payload")
+	}
+
+	return utils.FieldErrorResponse(c, fiber.StatusUnprocessableEntity, utils.CodeValidationFailed, "Validation failed", validationErr.Fields)
+}
+
+// passwordPolicyErrorResponse reports the password rule that failed against
+// field.
+func passwordPolicyErrorResponse(c *fiber.Ctx, field string, err error) error {
+	var policyErr *utils.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+	}
+
+	return utils.FieldErrorResponse(c, fiber.StatusUnprocessableEntity, utils.CodeValidationFailed, policyErr.Message, map[string]string{field: policyErr.Rule})
+}
@@ -1,26 +1,168 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"jwt-poc/app/api/handlers"
 	"jwt-poc/app/api/routes"
 	"jwt-poc/config"
+	"jwt-poc/middlewares"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
 )
 
+// Regenerate the OpenAPI spec in /docs after changing handler annotations
+// (needs the swag CLI: go install github.com/swaggo/swag/cmd/swag@v1.16.6).
+//go:generate swag init --dir ../.. --generalInfo app/api/main.go --output ../../docs --outputTypes go,json,yaml
+
+// @title                       jwt-poc API
+// @version                     1.0
+// @description                 JWT and API key authentication with Fiber and GORM.
+// @BasePath                    /
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 "Bearer " followed by an access token.
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        api-key
 func main() {
 	err := godotenv.Load()
 	if err != nil {
 		panic("Error loading .env file")
 	}
 
-	config.ConnectDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.AccessTokenTTL = cfg.AccessTokenTTL
+	utils.ImpersonationTokenTTL = cfg.ImpersonationTokenTTL
+	utils.SetBcryptCost(cfg.BcryptCost)
+	utils.SetMaintenanceMode(cfg.MaintenanceMode)
+	utils.SetCookieConfig(cfg.Cookies)
+	utils.SetRefreshTokenBytes(cfg.RefreshTokenBytes)
+	middlewares.SetRequestTimeout(cfg.RequestTimeout)
+	middlewares.SetIdempotencyKeyTTL(cfg.IdempotencyKeyTTL)
+	middlewares.SetAuthConfig(cfg.Auth)
+	middlewares.SetSecurityHeaders(cfg.SecurityHeaders)
+	middlewares.SetMaintenanceConfig(cfg.Maintenance)
+	services.LoadMailer(cfg.Mailer)
+	services.SetRefreshTokenMode(cfg.RefreshTokenMode)
+	services.SetUserDeleteMode(cfg.UserDeleteMode)
+	services.SetRegistrationTenant(cfg.RegistrationTenantID)
+	services.SetSessionConfig(cfg.Sessions)
+	services.SetLockoutConfig(cfg.Lockout)
+	services.SetVerificationConfig(cfg.Verification)
+	services.SetTOTPIssuer(cfg.TOTPIssuer)
+	handlers.SetBulkImportMaxUsers(cfg.BulkImportMaxUsers)
+	routes.SetDebugEndpoints(cfg.DebugEndpoints)
+	utils.RegisterMetrics()
+
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		if err := runCreateAdmin(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := utils.PrepareDummyHash(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := config.ConnectDB(cfg.Database); err != nil {
+		log.Fatal(err)
+	}
+	services.UseGormStores(config.DB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	shutdownTracing, err := utils.InitTracing(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go services.StartBlacklistCleanup(ctx, time.Hour)
+	go services.StartRefreshTokenCleanup(ctx, cfg.RefreshTokenCleanupInterval)
+	go services.StartIdempotencyKeyCleanup(ctx, time.Hour)
+	utils.StartJWKSRefresh(ctx)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: middlewares.ErrorHandler,
+		BodyLimit:    cfg.BodyLimit,
+	})
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace: true,
+	}))
+	app.Use(middlewares.SecurityHeadersMiddleware())
+	app.Use(middlewares.TracingMiddleware())
+	app.Use(middlewares.MetricsMiddleware())
+	app.Use(middlewares.MaintenanceMiddleware())
+	app.Use(middlewares.TimeoutMiddleware())
+
+	// Both servers report here when Listen fails, e.g. the port is taken.
+	listenErr := make(chan error, 2)
+
+	// /metrics is unauthenticated; METRICS_PORT moves it off the public port.
+	var metricsApp *fiber.App
+	if cfg.MetricsPort != "" {
+		metricsApp = fiber.New()
+		routes.MetricsRoutes(metricsApp)
+		go func() {
+			if err := metricsApp.Listen(":" + cfg.MetricsPort); err != nil {
+				listenErr <- fmt.Errorf("metrics server failed to listen on port %s: %w", cfg.MetricsPort, err)
+			}
+		}()
+	} else {
+		routes.MetricsRoutes(app)
+	}
 
-	app := fiber.New()
 	routes.RegisterRoutes(app)
 
-	port := os.Getenv("APP_PORT")
+	go func() {
+		if err := app.Listen(":" + cfg.Port); err != nil {
+			listenErr <- fmt.Errorf("server failed to listen on port %s: %w", cfg.Port, err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	exitCode := 0
+	select {
+	case <-quit:
+	case err := <-listenErr:
+		log.Println(err)
+		exitCode = 1
+	}
+
+	log.Println("Shutting down server...")
+	cancel()
+
+	if err := app.ShutdownWithTimeout(cfg.ShutdownTimeout); err != nil {
+		log.Println("server shutdown error:", err)
+	}
+	if metricsApp != nil {
+		if err := metricsApp.Shutdown(); err != nil {
+			log.Println("metrics server shutdown error:", err)
+		}
+	}
+
+	if err := config.CloseDB(); err != nil {
+		log.Println("failed to close database:", err)
+	}
+
+	// Uses a fresh context: ctx was cancelled above.
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Println("failed to flush traces:", err)
+	}
 
-	_ = app.Listen(":" + port)
+	log.Println("Server stopped")
+	os.Exit(exitCode)
 }
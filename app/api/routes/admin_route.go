@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"jwt-poc/app/api/handlers"
+	"jwt-poc/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AdminRoutes(router fiber.Router) {
+	admin := router.Group("/admin")
+	admin.Use(middlewares.AuthMiddleware(middlewares.WithFreshUserCheck()), middlewares.RequireRole("admin"))
+	admin.Get("/maintenance", handlers.GetMaintenanceHandler)
+	admin.Put("/maintenance", handlers.SetMaintenanceHandler)
+	admin.Post("/impersonate/:id", handlers.ImpersonateUserHandler)
+	admin.Delete("/tokens/:id", handlers.AdminRevokeTokenHandler)
+}
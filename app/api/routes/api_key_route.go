@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"jwt-poc/app/api/handlers"
+	"jwt-poc/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ApiKeyRoutes(router fiber.Router) {
+	apiKeys := router.Group("/apikeys")
+	apiKeys.Use(middlewares.AuthMiddleware(middlewares.WithFreshUserCheck()))
+	apiKeys.Get("/", middlewares.RequireScope("apikeys:read"), handlers.ListApiKeysHandler)
+	apiKeys.Post("/", middlewares.RequireScope("apikeys:write"), middlewares.RejectImpersonation(), middlewares.RequireVerifiedEmail(), handlers.CreateApiKeyHandler)
+	apiKeys.Delete("/:id", middlewares.RequireScope("apikeys:write"), middlewares.RejectImpersonation(), handlers.RevokeApiKeyHandler)
+	apiKeys.Post("/:id/rotate", middlewares.RequireScope("apikeys:write"), middlewares.RejectImpersonation(), middlewares.RequireVerifiedEmail(), handlers.RotateApiKeyHandler)
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"jwt-poc/app/api/handlers"
+	"jwt-poc/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AuditRoutes(router fiber.Router) {
+	audit := router.Group("/audit")
+	audit.Use(middlewares.AuthMiddleware(middlewares.WithFreshUserCheck()), middlewares.RequirePermission("audit:read"))
+	audit.Get("/", handlers.ListAuditLogsHandler)
+}
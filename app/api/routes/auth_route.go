@@ -2,13 +2,25 @@ package routes
 
 import (
 	"jwt-poc/app/api/handlers"
+	"jwt-poc/middlewares"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func AuthRoute(router fiber.Router) {
 	auth := router.Group("/auth")
+	// Fresh, so the credentials of deleted or deactivated users stop working
+	// at once, which /validate relies on for forward auth.
+	authenticated := middlewares.AuthMiddleware(middlewares.WithFreshUserCheck())
 
-	auth.Post("/login", handlers.LoginHandler)
+	auth.Post("/login", middlewares.LoginRateLimitMiddleware(), handlers.LoginHandler)
+	auth.Post("/2fa", middlewares.LoginRateLimitMiddleware(), handlers.TwoFactorLoginHandler)
 	auth.Post("/refresh", handlers.RefreshTokenHandler)
+	auth.Post("/logout", handlers.LogoutHandler)
+	auth.Post("/logout-all", authenticated, middlewares.RequireScope("sessions:write"), middlewares.RejectImpersonation(), handlers.LogoutAllHandler)
+	auth.Get("/verify", handlers.VerifyEmailHandler)
+	auth.Get("/me", authenticated, handlers.MeHandler)
+	auth.Get("/validate", authenticated, handlers.ValidateTokenHandler)
+	auth.Get("/sessions", authenticated, middlewares.RequireScope("sessions:read"), handlers.ListSessionsHandler)
+	auth.Delete("/sessions/:id", authenticated, middlewares.RequireScope("sessions:write"), middlewares.RejectImpersonation(), handlers.RevokeSessionHandler)
 }
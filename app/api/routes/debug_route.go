@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"jwt-poc/app/api/handlers"
+	"jwt-poc/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DebugRoutes are for development and integration only; RegisterRoutes adds
+// them only with DEBUG_ENDPOINTS=true.
+func DebugRoutes(router fiber.Router) {
+	debug := router.Group("/debug")
+	debug.Use(middlewares.AuthMiddleware(middlewares.WithFreshUserCheck()), middlewares.RequireRole("admin"))
+	debug.Post("/decode", handlers.DecodeTokenHandler)
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"jwt-poc/app/api/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func HealthRoutes(router fiber.Router) {
+	router.Get("/healthz", handlers.HealthzHandler)
+	router.Get("/readyz", handlers.ReadyzHandler)
+}
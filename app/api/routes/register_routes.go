@@ -1,9 +1,34 @@
 package routes
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var debugEndpoints bool
+
+// SetDebugEndpoints applies DEBUG_ENDPOINTS once at startup, before
+// RegisterRoutes.
+func SetDebugEndpoints(enabled bool) {
+	debugEndpoints = enabled
+}
 
 func RegisterRoutes(app *fiber.App) {
+	HealthRoutes(app)
+	SwaggerRoutes(app)
+
 	api := app.Group("/api")
 	AuthRoute(api)
 	UserRoutes(api)
+	ApiKeyRoutes(api)
+	AuditRoutes(api)
+	AdminRoutes(api)
+	WebSocketRoutes(api)
+
+	// Never enable in production.
+	if debugEndpoints {
+		log.Println("warning: DEBUG_ENDPOINTS is on, /api/debug is exposed to admins")
+		DebugRoutes(api)
+	}
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	_ "jwt-poc/docs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/swagger"
+)
+
+// SwaggerRoutes serves the UI and spec generated into /docs by swag init.
+func SwaggerRoutes(router fiber.Router) {
+	router.Get("/swagger/*", swagger.HandlerDefault)
+}
@@ -9,7 +9,21 @@ import (
 
 func UserRoutes(router fiber.Router) {
 	user := router.Group("/user")
-	user.Post("/register", handlers.CreateUserHandler)
-	user.Use(middlewares.AuthMiddleware())
-	user.Get("/profile", handlers.ProfileHandler)
+	user.Post("/register", middlewares.Idempotency(), handlers.CreateUserHandler)
+	user.Use(middlewares.AuthMiddleware(middlewares.WithFreshUserCheck()))
+	user.Get("/profile", middlewares.RequireScope("profile:read"), handlers.ProfileHandler)
+	user.Post("/change-password", middlewares.RequireScope("profile:write"), middlewares.RejectImpersonation(), handlers.ChangePasswordHandler)
+	user.Patch("/email", middlewares.RequireScope("profile:write"), middlewares.RejectImpersonation(), handlers.UpdateEmailHandler)
+	user.Post("/2fa/enroll", middlewares.RequireScope("profile:write"), middlewares.RejectImpersonation(), handlers.EnrollTwoFactorHandler)
+	user.Post("/2fa/verify", middlewares.RequireScope("profile:write"), middlewares.RejectImpersonation(), handlers.VerifyTwoFactorHandler)
+	user.Get("/", middlewares.RequirePermission("user:list"), handlers.ListUsersHandler)
+	user.Post("/bulk", middlewares.RequirePermission("user:create"), handlers.BulkCreateUsersHandler)
+	user.Delete("/:id", middlewares.RequirePermission("user:delete"), handlers.DeleteUserHandler)
+	user.Patch("/:id/role", middlewares.RequirePermission("user:role"), handlers.ChangeUserRoleHandler)
+	user.Post("/:id/deactivate", middlewares.RequirePermission("user:deactivate"), handlers.DeactivateUserHandler)
+	user.Post("/:id/reactivate", middlewares.RequirePermission("user:deactivate"), handlers.ReactivateUserHandler)
+	// Only admins hand out permissions, so a grant can't be used to gain more.
+	user.Get("/:id/permissions", middlewares.RequireRole("admin"), handlers.ListUserPermissionsHandler)
+	user.Post("/:id/permissions", middlewares.RequireRole("admin"), handlers.GrantPermissionHandler)
+	user.Delete("/:id/permissions/:permission", middlewares.RequireRole("admin"), handlers.RevokePermissionHandler)
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"jwt-poc/app/api/handlers"
+	"jwt-poc/middlewares"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+func WebSocketRoutes(router fiber.Router) {
+	router.Get("/ws", middlewares.WebSocketAuth(), websocket.New(handlers.NotificationSocketHandler, websocket.Config{
+		// Echoed back to browsers that send the JWT as a subprotocol.
+		Subprotocols: []string{middlewares.WebSocketTokenProtocol},
+	}))
+}
@@ -0,0 +1,394 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"jwt-poc/utils"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config is the startup configuration, read once by Load. main hands each part
+// to the package that uses it; nothing reads the environment per request. The
+// OTEL_* variables are left to the OpenTelemetry SDK.
+type Config struct {
+	Port        string
+	MetricsPort string
+	BodyLimit   int
+	// ShutdownTimeout bounds the graceful shutdown.
+	ShutdownTimeout time.Duration
+	// RequestTimeout is 0 when requests have no deadline; see
+	// middlewares.SetRequestTimeout.
+	RequestTimeout              time.Duration
+	RefreshTokenCleanupInterval time.Duration
+	AccessTokenTTL              time.Duration
+	// ImpersonationTokenTTL is at most AccessTokenTTL.
+	ImpersonationTokenTTL time.Duration
+	BcryptCost            int
+	// RefreshTokenMode is opaque or jwt; see services.SetRefreshTokenMode.
+	RefreshTokenMode string
+	// UserDeleteMode is soft or hard; see services.SetUserDeleteMode.
+	UserDeleteMode string
+	// RegistrationTenantID is the tenant of self-registered users.
+	RegistrationTenantID uint
+	MaintenanceMode      bool
+	// IdempotencyKeyTTL is how long middlewares.Idempotency keeps responses.
+	IdempotencyKeyTTL time.Duration
+	// BulkImportMaxUsers caps the rows of one bulk user import.
+	BulkImportMaxUsers int
+	// RefreshTokenBytes is the size of opaque refresh tokens, at least 16.
+	RefreshTokenBytes int
+	TOTPIssuer        string
+	// DebugEndpoints exposes /api/debug to admins; never enable in production.
+	DebugEndpoints  bool
+	Auth            AuthConfig
+	Sessions        SessionConfig
+	Lockout         LockoutConfig
+	Verification    VerificationConfig
+	Cookies         utils.CookieConfig
+	SecurityHeaders SecurityHeadersConfig
+	Maintenance     MaintenanceConfig
+	Database        DatabaseConfig
+	Mailer          MailerConfig
+}
+
+// AuthConfig tunes AuthMiddleware and the login rate limit; see
+// middlewares.SetAuthConfig.
+type AuthConfig struct {
+	// Precedence is jwt or api_key, the credential that wins when a request
+	// carries both.
+	Precedence        string
+	FallbackOnInvalid bool
+	// APIKeyRateLimit is per minute for keys without their own; 0 is unlimited.
+	APIKeyRateLimit        int
+	APIKeyLastUsedInterval time.Duration
+	LoginRateLimit         int
+	LoginRateWindow        time.Duration
+}
+
+// SessionConfig limits refresh token sessions; see services.SetSessionConfig.
+type SessionConfig struct {
+	RotationGrace time.Duration
+	// IdleTimeout is 0 when sessions never idle out.
+	IdleTimeout time.Duration
+	// MaxPerUser is 0 for no limit.
+	MaxPerUser              int
+	RevokeOnBindingMismatch bool
+}
+
+// LockoutConfig locks an account for Duration after Threshold failed logins in
+// a row; see services.SetLockoutConfig.
+type LockoutConfig struct {
+	Threshold int
+	Duration  time.Duration
+}
+
+// VerificationConfig covers email verification; see
+// services.SetVerificationConfig.
+type VerificationConfig struct {
+	Required bool
+	// AppBaseURL makes verification links absolute.
+	AppBaseURL string
+	// EmailChangeMode is pending or block.
+	EmailChangeMode string
+}
+
+// SecurityHeadersConfig holds the header values, "off" leaving one out, and
+// HSTSMaxAge, 0 when Strict-Transport-Security is not sent.
+type SecurityHeadersConfig struct {
+	ContentTypeOptions    string
+	FrameOptions          string
+	ReferrerPolicy        string
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+}
+
+// MaintenanceConfig is what MaintenanceMiddleware blocks while maintenance mode
+// is on: BlockedMethods, except on paths starting with one of AllowPaths.
+type MaintenanceConfig struct {
+	BlockedMethods []string
+	AllowPaths     []string
+}
+
+type DatabaseConfig struct {
+	// Driver is sqlite or postgres.
+	Driver string
+	// URL is the postgres DSN.
+	URL        string
+	SQLitePath string
+	Seed       bool
+}
+
+// MailerConfig selects how mail is sent: log prints it, smtp sends it through
+// SMTPHost:SMTPPort, authenticating when SMTPUsername is set.
+type MailerConfig struct {
+	Kind         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+}
+
+// Load reads and checks the startup configuration, including the JWT keys and
+// the password settings kept in utils. Instead of falling back to defaults,
+// malformed values are errors, and every problem found is reported in one
+// error.
+func Load() (*Config, error) {
+	env := &envReader{}
+	cfg := &Config{
+		Port:                        env.string("APP_PORT", "3000"),
+		MetricsPort:                 os.Getenv("METRICS_PORT"),
+		BodyLimit:                   env.int("BODY_LIMIT", 1024*1024),
+		ShutdownTimeout:             env.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		RequestTimeout:              env.durationOrOff("REQUEST_TIMEOUT", 10*time.Second),
+		RefreshTokenCleanupInterval: env.duration("REFRESH_TOKEN_CLEANUP_INTERVAL", time.Hour),
+		AccessTokenTTL:              env.duration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		BcryptCost:                  env.int("BCRYPT_COST", utils.DefaultBcryptCost),
+		RefreshTokenMode:            env.oneOf("REFRESH_TOKEN_MODE", "opaque", "opaque", "jwt"),
+		UserDeleteMode:              env.oneOf("USER_DELETE_MODE", "soft", "soft", "hard"),
+		MaintenanceMode:             env.bool("MAINTENANCE_MODE", false),
+		IdempotencyKeyTTL:           env.duration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		BulkImportMaxUsers:          env.int("BULK_IMPORT_MAX_USERS", 100),
+		RefreshTokenBytes:           env.int("REFRESH_TOKEN_BYTES", 32),
+		TOTPIssuer:                  env.string("TOTP_ISSUER", "jwt-poc"),
+		DebugEndpoints:              env.bool("DEBUG_ENDPOINTS", false),
+		Auth: AuthConfig{
+			Precedence:             env.oneOf("AUTH_PRECEDENCE", "jwt", "jwt", "api_key"),
+			FallbackOnInvalid:      env.bool("AUTH_FALLBACK_ON_INVALID", false),
+			APIKeyRateLimit:        env.int("API_KEY_RATE_LIMIT", 0),
+			APIKeyLastUsedInterval: env.duration("API_KEY_LAST_USED_INTERVAL", 5*time.Minute),
+			LoginRateLimit:         env.int("LOGIN_RATE_LIMIT", 5),
+			LoginRateWindow:        env.duration("LOGIN_RATE_WINDOW", time.Minute),
+		},
+		Sessions: SessionConfig{
+			RotationGrace:           env.duration("REFRESH_ROTATION_GRACE", 10*time.Second),
+			IdleTimeout:             env.durationOrOff("REFRESH_IDLE_TIMEOUT", 0),
+			MaxPerUser:              env.int("MAX_SESSIONS_PER_USER", 5),
+			RevokeOnBindingMismatch: env.bool("REFRESH_TOKEN_BINDING_REVOKE", false),
+		},
+		Lockout: LockoutConfig{
+			Threshold: env.int("LOCKOUT_THRESHOLD", 5),
+			Duration:  env.duration("LOCKOUT_DURATION", 15*time.Minute),
+		},
+		Verification: VerificationConfig{
+			Required:        env.bool("REQUIRE_EMAIL_VERIFICATION", false),
+			AppBaseURL:      os.Getenv("APP_BASE_URL"),
+			EmailChangeMode: env.oneOf("EMAIL_CHANGE_MODE", "pending", "pending", "block"),
+		},
+		Cookies: utils.CookieConfig{
+			AccessTokenName:  env.string("ACCESS_TOKEN_COOKIE_NAME", "access_token"),
+			RefreshTokenName: env.string("REFRESH_TOKEN_COOKIE_NAME", "refresh_token"),
+			RefreshTokenPath: env.string("REFRESH_TOKEN_COOKIE_PATH", "/api/auth"),
+			Secure:           env.bool("COOKIE_SECURE", true),
+			SameSite:         env.oneOf("COOKIE_SAMESITE", "Strict", "Strict", "Lax", "None"),
+		},
+		SecurityHeaders: SecurityHeadersConfig{
+			ContentTypeOptions:    env.string("SECURITY_HEADER_CONTENT_TYPE_OPTIONS", "nosniff"),
+			FrameOptions:          env.string("SECURITY_HEADER_FRAME_OPTIONS", "DENY"),
+			ReferrerPolicy:        env.string("SECURITY_HEADER_REFERRER_POLICY", "no-referrer"),
+			HSTSMaxAge:            env.durationOrOff("HSTS_MAX_AGE", 0),
+			HSTSIncludeSubdomains: env.bool("HSTS_INCLUDE_SUBDOMAINS", false),
+		},
+		Maintenance: MaintenanceConfig{
+			BlockedMethods: env.list("MAINTENANCE_BLOCKED_METHODS", []string{"POST", "PUT", "PATCH", "DELETE"}),
+			AllowPaths:     env.list("MAINTENANCE_ALLOW_PATHS", []string{"/api/auth/login", "/api/auth/2fa", "/api/auth/refresh", "/api/auth/logout"}),
+		},
+		Database: DatabaseConfig{
+			Driver:     env.oneOf("DB_DRIVER", "sqlite", "sqlite", "postgres"),
+			URL:        os.Getenv("DATABASE_URL"),
+			SQLitePath: os.Getenv("SQLITE_PATH"),
+			Seed:       env.bool("SEED_DB", false),
+		},
+		Mailer: MailerConfig{
+			Kind:         env.oneOf("MAILER", "log", "log", "smtp"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     env.int("SMTP_PORT", 587),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			SMTPFrom:     os.Getenv("SMTP_FROM"),
+		},
+	}
+
+	if tenantID := env.int("REGISTRATION_TENANT_ID", 0); tenantID < 0 {
+		env.fail("REGISTRATION_TENANT_ID must not be negative")
+	} else {
+		cfg.RegistrationTenantID = uint(tenantID)
+	}
+
+	env.port("APP_PORT", cfg.Port)
+	env.port("METRICS_PORT", cfg.MetricsPort)
+	cfg.ImpersonationTokenTTL = env.duration("IMPERSONATION_TOKEN_TTL", min(5*time.Minute, cfg.AccessTokenTTL))
+	if cfg.ImpersonationTokenTTL > cfg.AccessTokenTTL {
+		env.fail("IMPERSONATION_TOKEN_TTL must not exceed ACCESS_TOKEN_TTL")
+	}
+	if cfg.BodyLimit <= 0 {
+		env.fail("BODY_LIMIT must be positive")
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		env.fail(fmt.Sprintf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	if cfg.Database.Driver == "postgres" && cfg.Database.URL == "" {
+		env.fail("DB_DRIVER=postgres needs DATABASE_URL")
+	}
+	if cfg.Database.SQLitePath == "" {
+		cfg.Database.SQLitePath = "gofiber_auth.db"
+	}
+	if cfg.Mailer.Kind == "smtp" && (cfg.Mailer.SMTPHost == "" || cfg.Mailer.SMTPFrom == "") {
+		env.fail("MAILER=smtp needs SMTP_HOST and SMTP_FROM")
+	}
+	if cfg.BulkImportMaxUsers <= 0 {
+		env.fail("BULK_IMPORT_MAX_USERS must be positive")
+	}
+	if cfg.RefreshTokenBytes < 16 {
+		env.fail("REFRESH_TOKEN_BYTES must be at least 16")
+	}
+	if cfg.Auth.APIKeyRateLimit < 0 {
+		env.fail("API_KEY_RATE_LIMIT must not be negative")
+	}
+	if cfg.Auth.LoginRateLimit <= 0 {
+		env.fail("LOGIN_RATE_LIMIT must be positive")
+	}
+	if cfg.Sessions.MaxPerUser < 0 {
+		env.fail("MAX_SESSIONS_PER_USER must not be negative")
+	}
+	if cfg.Lockout.Threshold <= 0 {
+		env.fail("LOCKOUT_THRESHOLD must be positive")
+	}
+	if cfg.Cookies.SameSite == "None" && !cfg.Cookies.Secure {
+		env.fail("COOKIE_SAMESITE=None needs COOKIE_SECURE=true")
+	}
+	for i, method := range cfg.Maintenance.BlockedMethods {
+		cfg.Maintenance.BlockedMethods[i] = strings.ToUpper(method)
+	}
+
+	env.check(utils.LoadJWTConfig())
+	env.check(utils.LoadPasswordHashAlgo())
+	env.check(utils.LoadPasswordPolicy())
+	env.check(utils.LoadRefreshTokenBinding())
+	env.check(utils.LoadRolePermissions())
+
+	if len(env.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(env.errs...))
+	}
+	return cfg, nil
+}
+
+// envReader parses environment variables strictly and collects the problems.
+// A malformed value yields the fallback so the checks after it don't report
+// it twice.
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) fail(message string) {
+	r.errs = append(r.errs, errors.New(message))
+}
+
+func (r *envReader) check(err error) {
+	if err != nil {
+		r.errs = append(r.errs, err)
+	}
+}
+
+func (r *envReader) string(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (r *envReader) int(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		r.fail(fmt.Sprintf("%s must be an integer, got %q", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+func (r *envReader) duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		r.fail(fmt.Sprintf("%s must be a positive duration such as 15m, got %q", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+// durationOrOff is duration for settings that 0 turns off.
+func (r *envReader) durationOrOff(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		r.fail(fmt.Sprintf("%s must be a duration such as 15m, or 0 to turn it off, got %q", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+func (r *envReader) bool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		r.fail(fmt.Sprintf("%s must be true or false, got %q", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+func (r *envReader) oneOf(key, fallback string, allowed ...string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	if slices.Contains(allowed, value) {
+		return value
+	}
+	r.fail(fmt.Sprintf("%s must be one of %v, got %q", key, allowed, value))
+	return value
+}
+
+// list splits a comma-separated value, dropping empty entries.
+func (r *envReader) list(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	var values []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			values = append(values, entry)
+		}
+	}
+	return values
+}
+
+func (r *envReader) port(key, value string) {
+	if value == "" {
+		return
+	}
+	if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+		r.fail(fmt.Sprintf("%s must be a port between 1 and 65535, got %q", key, value))
+	}
+}
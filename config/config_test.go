@@ -0,0 +1,67 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRequestTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 10 * time.Second, false},
+		{"30s", 30 * time.Second, false},
+		{"0", 0, false},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("SECRET_KEY", strings.Repeat("s", 32))
+			t.Setenv("REQUEST_TIMEOUT", tt.value)
+
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "REQUEST_TIMEOUT") {
+					t.Fatalf("err = %v, want one naming REQUEST_TIMEOUT", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.RequestTimeout != tt.want {
+				t.Errorf("RequestTimeout = %s, want %s", cfg.RequestTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("SECRET_KEY", strings.Repeat("s", 32))
+	bad := map[string]string{
+		"LOCKOUT_THRESHOLD":      "five",
+		"MAX_SESSIONS_PER_USER":  "-1",
+		"REFRESH_ROTATION_GRACE": "0",
+		"COOKIE_SAMESITE":        "Loose",
+		"AUTH_PRECEDENCE":        "cookie",
+		"PASSWORD_REQUIRE_UPPER": "maybe",
+	}
+	for key, value := range bad {
+		t.Setenv(key, value)
+	}
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load succeeded, want an error")
+	}
+	for key := range bad {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s:\n%v", key, err)
+		}
+	}
+}
@@ -3,30 +3,159 @@ package config
 import (
 	"fmt"
 	"jwt-poc/models"
-	"log"
+	"jwt-poc/utils"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-func ConnectDB() {
-	dbName := "gofiber_auth.db"
-	var err error
+// ConnectDB connects to the configured database, runs the migrations and sets
+// DB. Errors are returned so the caller decides whether to exit.
+func ConnectDB(cfg DatabaseConfig) error {
+	if cfg.Driver == "sqlite" && cfg.SQLitePath != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0o755); err != nil {
+			return fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	DB = db
+	return nil
+}
+
+// ConnectDBWithDSN opens DB_DRIVER (sqlite by default) with dsn as the SQLite
+// path or postgres URL and runs the migrations without touching DB, seeding it
+// when SEED_DB is set. It is OpenDB for callers without a DatabaseConfig.
+func ConnectDBWithDSN(dsn string) (*gorm.DB, error) {
+	cfg := DatabaseConfig{Driver: "sqlite", URL: dsn, SQLitePath: dsn, Seed: utils.GetEnvBool("SEED_DB", false)}
+	if driver := os.Getenv("DB_DRIVER"); driver != "" {
+		cfg.Driver = driver
+	}
+	return OpenDB(cfg)
+}
+
+// OpenDB opens the database and runs the migrations without touching DB, so
+// tests can point SQLitePath at a temp file or ":memory:".
+func OpenDB(cfg DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case "sqlite":
+		dialector = sqlite.Open(sqliteDSN(cfg.SQLitePath))
+	case "postgres":
+		dialector = postgres.Open(cfg.URL)
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q (expected sqlite or postgres)", cfg.Driver)
+	}
 
-	DB, err = gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		log.Fatal("failed to connect database", err)
+		return nil, fmt.Errorf("failed to connect database: %w", err)
+	}
+	if err := registerTracing(db); err != nil {
+		return nil, fmt.Errorf("failed to register query tracing: %w", err)
 	}
 
 	fmt.Println("Database connected successfully")
 
-	err = DB.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.ApiKey{})
+	if err := deleteOrphans(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := dropGlobalUserConstraints(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.ApiKey{}, &models.TokenBlacklist{}, &models.VerificationToken{}, &models.TwoFactorChallenge{}, &models.AuditLog{}, &models.IdempotencyKey{}, &models.UserPermission{})
 
 	if err != nil {
-		log.Fatal("failed to migrate database")
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	fmt.Println("Database migrated successfully")
+
+	if cfg.Seed {
+		if err := Seed(db); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// sqliteDSN turns on foreign-key enforcement, which SQLite leaves off for every
+// new connection; without it the ON DELETE CASCADE constraints are ignored.
+func sqliteDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_foreign_keys=on"
+}
+
+// userOwnedModels have a user_id referencing users with ON DELETE CASCADE.
+var userOwnedModels = []any{&models.RefreshToken{}, &models.ApiKey{}, &models.VerificationToken{}, &models.TwoFactorChallenge{}, &models.UserPermission{}}
+
+// deleteOrphans removes rows whose user no longer exists, written before the
+// foreign keys were added, as AutoMigrate can't add a constraint they violate.
+// Rows of soft-deleted users are kept.
+func deleteOrphans(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.User{}) {
+		return nil
+	}
+
+	userIDs := db.Unscoped().Model(&models.User{}).Select("id")
+	for _, model := range userOwnedModels {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+		if err := db.Where("user_id NOT IN (?)", userIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globalUserConstraints made usernames and emails unique across tenants: the
+// names GORM gives them, and the ones Postgres gave the inline constraints of
+// older GORM versions.
+var globalUserConstraints = []string{"uni_users_username", "uni_users_email", "users_username_key", "users_email_key"}
+
+// dropGlobalUserConstraints lets two tenants use the same username or email;
+// the per-tenant unique indexes replace them. SQLite has no named constraints
+// to drop here, as AutoMigrate rebuilds the table without the inline ones.
+func dropGlobalUserConstraints(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.User{}) {
+		return nil
+	}
+
+	for _, name := range globalUserConstraints {
+		if !db.Migrator().HasConstraint(&models.User{}, name) {
+			continue
+		}
+		if err := db.Migrator().DropConstraint(&models.User{}, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CloseDB() error {
+	if DB == nil {
+		return nil
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
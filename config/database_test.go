@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"jwt-poc/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestOpenDBCascadesUserDelete(t *testing.T) {
+	db, err := OpenDB(DatabaseConfig{Driver: "sqlite", SQLitePath: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a separate, empty database.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	user := models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x", Role: "user", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	owned := []any{
+		&models.RefreshToken{UserID: user.ID, TokenHash: "token-hash", ExpiryDate: time.Now().Add(time.Hour)},
+		&models.ApiKey{UserID: user.ID, Prefix: "abcd1234", KeyHash: "key-hash", Client: "cli"},
+		&models.VerificationToken{UserID: user.ID, Token: "verification", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	for _, row := range owned {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Create(&models.ApiKey{UserID: user.ID + 1, Prefix: "orphan00", KeyHash: "orphan-hash", Client: "cli"}).Error; err == nil {
+		t.Error("inserting an API key for a missing user succeeded, want a foreign key error")
+	}
+
+	if err := db.Delete(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertCount(t, db.Model(&models.RefreshToken{}), 1, "refresh tokens after soft delete")
+
+	if err := db.Unscoped().Delete(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, model := range []any{&models.RefreshToken{}, &models.ApiKey{}, &models.VerificationToken{}} {
+		assertCount(t, db.Model(model), 0, fmt.Sprintf("%T rows after hard delete", model))
+	}
+}
+
+// globalUniqueUser is the users table from before usernames and emails became
+// unique per tenant.
+type globalUniqueUser struct {
+	ID           uint   `gorm:"primaryKey"`
+	Username     string `gorm:"unique;not null"`
+	Email        string `gorm:"unique;not null"`
+	TenantID     uint   `gorm:"not null;default:0;index"`
+	PasswordHash string `gorm:"not null"`
+}
+
+func (globalUniqueUser) TableName() string { return "users" }
+
+func TestOpenDBMakesUsersUniquePerTenant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	old, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.AutoMigrate(&globalUniqueUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Create(&globalUniqueUser{Username: "alice", Email: "alice@example.com", TenantID: 1, PasswordHash: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := old.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	db, err := OpenDB(DatabaseConfig{Driver: "sqlite", SQLitePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.Create(&models.User{Username: "alice", Email: "alice@example.com", TenantID: 2, PasswordHash: "x"}).Error; err != nil {
+		t.Errorf("alice in a second tenant: %v", err)
+	}
+	if err := db.Create(&models.User{Username: "alice", Email: "other@example.com", TenantID: 2, PasswordHash: "x"}).Error; err == nil {
+		t.Error("second alice in the same tenant succeeded, want a unique violation")
+	}
+	if err := db.Create(&models.User{Username: "bob", Email: "alice@example.com", TenantID: 1, PasswordHash: "x"}).Error; err == nil {
+		t.Error("reused email in the same tenant succeeded, want a unique violation")
+	}
+}
+
+func assertCount(t *testing.T, query *gorm.DB, want int64, what string) {
+	t.Helper()
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != want {
+		t.Errorf("%s = %d, want %d", what, count, want)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+type seedUser struct {
+	username, email, password, role string
+}
+
+// Seed creates a known admin and regular user for local development. Users that
+// already exist, including soft-deleted ones, are left untouched, so it is safe
+// to run on every start. Credentials come from SEED_ADMIN_* and SEED_USER_*.
+func Seed(db *gorm.DB) error {
+	users := []seedUser{
+		{
+			username: envOrDefault("SEED_ADMIN_USERNAME", "admin"),
+			email:    envOrDefault("SEED_ADMIN_EMAIL", "admin@example.com"),
+			password: envOrDefault("SEED_ADMIN_PASSWORD", "admin12345"),
+			role:     "admin",
+		},
+		{
+			username: envOrDefault("SEED_USER_USERNAME", "user"),
+			email:    envOrDefault("SEED_USER_EMAIL", "user@example.com"),
+			password: envOrDefault("SEED_USER_PASSWORD", "user12345"),
+			role:     "user",
+		},
+	}
+
+	for _, u := range users {
+		var existing int64
+		if err := db.Unscoped().Model(&models.User{}).Where("username = ? AND tenant_id = ?", u.username, 0).Count(&existing).Error; err != nil {
+			return fmt.Errorf("failed to seed user %q: %w", u.username, err)
+		}
+		if existing > 0 {
+			continue
+		}
+
+		hashedPassword, err := utils.HashPassword(u.password)
+		if err != nil {
+			return fmt.Errorf("failed to seed user %q: %w", u.username, err)
+		}
+
+		user := models.User{
+			Username:      u.username,
+			Email:         u.email,
+			PasswordHash:  hashedPassword,
+			Role:          u.role,
+			EmailVerified: true,
+		}
+		if err := db.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to seed user %q: %w", u.username, err)
+		}
+		fmt.Printf("Seeded %s user %q\n", u.role, u.username)
+	}
+
+	return nil
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,62 @@
+// Package testdb gives tests a fresh database wired into config and services.
+package testdb
+
+import (
+	"context"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Password is the password of every user made by CreateUser.
+const Password = "Password123!"
+
+// Open points config.DB and the services' stores at a fresh SQLite database
+// that is closed when the test ends. It also loads an HS256 JWT config and
+// drops the bcrypt cost to the minimum so logins stay fast.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	t.Setenv("SECRET_KEY", strings.Repeat("s", 32))
+	if err := utils.LoadJWTConfig(); err != nil {
+		t.Fatal(err)
+	}
+	utils.SetBcryptCost(bcrypt.MinCost)
+	if err := utils.PrepareDummyHash(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := config.OpenDB(config.DatabaseConfig{Driver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DB = db
+	services.UseGormStores(db)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// CreateUser adds an active user with a verified email, username@example.com,
+// and Password.
+func CreateUser(t testing.TB, username string) models.User {
+	t.Helper()
+	hash, err := utils.HashPassword(Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: username, Email: username + "@example.com", PasswordHash: hash, Role: "user", EmailVerified: true, IsActive: true}
+	if err := services.CreateUser(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
@@ -1,72 +1,339 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"jwt-poc/config"
 	"jwt-poc/models"
+	"jwt-poc/services"
 	"jwt-poc/utils"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
-func AuthMiddleware() fiber.Handler {
+var authConfig = config.AuthConfig{
+	Precedence:             "jwt",
+	APIKeyLastUsedInterval: 5 * time.Minute,
+	LoginRateLimit:         5,
+	LoginRateWindow:        time.Minute,
+}
+
+// SetAuthConfig applies AUTH_PRECEDENCE, AUTH_FALLBACK_ON_INVALID,
+// API_KEY_RATE_LIMIT, API_KEY_LAST_USED_INTERVAL and LOGIN_RATE_* once at
+// startup, before the middlewares are created; config.Load has already
+// checked them.
+func SetAuthConfig(cfg config.AuthConfig) {
+	authConfig = cfg
+}
+
+type authOptions struct {
+	freshUserCheck bool
+}
+
+type AuthOption func(*authOptions)
+
+// WithFreshUserCheck loads the user behind a JWT or API key on every request:
+// credentials of deleted or deactivated users are rejected and, for JWTs, the
+// role and email_verified from the database replace the claims, so demotions
+// apply immediately instead of after the token expires.
+// It costs one extra query per request. Tokens from a trusted issuer are
+// exempt: they name no local user.
+func WithFreshUserCheck() AuthOption {
+	return func(o *authOptions) {
+		o.freshUserCheck = true
+	}
+}
+
+// authError is an authentication failure that hasn't been written yet, so a
+// request carrying both credentials can still fall back to the other one.
+type authError struct {
+	status    int
+	code      string
+	message   string
+	challenge string
+}
+
+func (e *authError) send(c *fiber.Ctx) error {
+	if e.challenge != "" {
+		setBearerChallenge(c, e.challenge)
+	}
+	return utils.ErrorResponse(c, e.status, e.code, e.message)
+}
+
+var errInternalAuth = &authError{status: fiber.StatusInternalServerError, code: utils.CodeInternalError, message: "Internal server error"}
+
+// AuthMiddleware accepts a JWT (Authorization header or access token cookie) or
+// an api-key header. When a request carries both, both are checked:
+//
+//   - AUTH_PRECEDENCE ("jwt" by default, or "api_key") picks which one sets
+//     the caller's identity.
+//   - If the preferred credential is invalid the request fails, unless
+//     AUTH_FALLBACK_ON_INVALID is true and the other one is valid.
+//   - An invalid non-preferred credential is ignored, so a proxy injecting a
+//     stale default api-key doesn't break JWT callers.
+//   - If both are valid but belong to different users the request fails.
+func AuthMiddleware(opts ...AuthOption) fiber.Handler {
+	options := authOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	preferAPIKey := authConfig.Precedence == "api_key"
+	fallbackOnInvalid := authConfig.FallbackOnInvalid
+	defaultKeyLimit := authConfig.APIKeyRateLimit
+	keyLastUsedInterval := authConfig.APIKeyLastUsedInterval
+
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		apiKeyHeader := c.Get("api-key")
-
-		// 🔹 1. Cek Authorization (Bearer JWT)
-		if authHeader != "" {
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Invalid or malformed Authorization header",
-				})
+		// Header names are matched case-insensitively by fasthttp.
+		apiKeyHeader := utils.NormalizeApiKey(c.Get("api-key"))
+		tokenString, authErr := bearerToken(c)
+		if authErr != nil {
+			return authErr.send(c)
+		}
+
+		switch {
+		// 🔹 Kalau dua-duanya kosong
+		case tokenString == "" && apiKeyHeader == "":
+			setBearerChallenge(c, "")
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Missing authentication (JWT or API Key)")
+
+		// 🔹 1. Cek JWT (Authorization header atau cookie)
+		case apiKeyHeader == "":
+			claims, authErr := checkJWT(c.UserContext(), tokenString, options)
+			if authErr != nil {
+				return authErr.send(c)
 			}
+			setJWTLocals(c, claims)
+			return c.Next()
+
+		// 🔹 2. Cek X-API-Key
+		case tokenString == "":
+			apiKey, authErr := checkAPIKey(c.UserContext(), apiKeyHeader, options)
+			if authErr != nil {
+				return authErr.send(c)
+			}
+			// Rate-limited requests count as uses too.
+			services.TouchApiKey(c.UserContext(), apiKey, keyLastUsedInterval)
+			if limited, resetAt := apiKeyRateLimited(apiKey, defaultKeyLimit); limited {
+				return tooManyRequests(c, resetAt)
+			}
+			setAPIKeyLocals(c, apiKey)
+			return c.Next()
+		}
+
+		claims, jwtErr := checkJWT(c.UserContext(), tokenString, options)
+		apiKey, keyErr := checkAPIKey(c.UserContext(), apiKeyHeader, options)
+		if jwtErr == errInternalAuth || keyErr == errInternalAuth {
+			return errInternalAuth.send(c)
+		}
+
+		if jwtErr == nil && keyErr == nil && claims.UserID != apiKey.UserID {
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "JWT and API key identify different users")
+		}
 
-			tokenString := parts[1]
+		useAPIKey := preferAPIKey
+		if preferAPIKey && keyErr != nil {
+			if !fallbackOnInvalid || jwtErr != nil {
+				return keyErr.send(c)
+			}
+			useAPIKey = false
+		}
+		if !preferAPIKey && jwtErr != nil {
+			if !fallbackOnInvalid || keyErr != nil {
+				return jwtErr.send(c)
+			}
+			useAPIKey = true
+		}
 
-			// Validate JWT token
-			claims, err := utils.ValidateJWT(tokenString)
-			if err != nil {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Invalid or expired JWT",
-				})
+		if useAPIKey {
+			services.TouchApiKey(c.UserContext(), apiKey, keyLastUsedInterval)
+			if limited, resetAt := apiKeyRateLimited(apiKey, defaultKeyLimit); limited {
+				return tooManyRequests(c, resetAt)
 			}
+			setAPIKeyLocals(c, apiKey)
+		} else {
+			setJWTLocals(c, claims)
+		}
+		return c.Next()
+	}
+}
 
-			// Store user information in context
-			c.Locals("userID", claims.UserID)
-			c.Locals("role", claims.Role)
-			c.Locals("authType", "JWT")
+// bearerToken reads the JWT. The header wins; browsers fall back to the
+// HttpOnly cookie set at login.
+func bearerToken(c *fiber.Ctx) (string, *authError) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return c.Cookies(utils.AccessTokenCookieName()), nil
+	}
 
-			return c.Next()
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "Invalid or malformed Authorization header", challenge: "invalid_request"}
+	}
+	return parts[1], nil
+}
+
+func checkJWT(ctx context.Context, tokenString string, options authOptions) (*utils.Claims, *authError) {
+	// Validate JWT token
+	claims, err := utils.ValidateJWT(tokenString)
+	if err != nil {
+		utils.JWTValidationFailuresTotal.Inc()
+		return nil, invalidJWTError(err)
+	}
+
+	blacklisted, err := services.IsTokenBlacklisted(ctx, claims.ID)
+	if err != nil {
+		return nil, errInternalAuth
+	}
+	if blacklisted {
+		return nil, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "Token has been revoked", challenge: "invalid_token"}
+	}
+
+	if options.freshUserCheck && !claims.External {
+		user, authErr := freshUser(ctx, claims.UserID, "invalid_token")
+		if authErr != nil {
+			return nil, authErr
 		}
+		if user.TenantID != claims.TenantID() {
+			return nil, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "Token tenant does not match user", challenge: "invalid_token"}
+		}
+		claims.Role = user.Role
+		if claims.Extra == nil {
+			claims.Extra = map[string]any{}
+		}
+		claims.Extra["email_verified"] = user.EmailVerified
+		claims.Extra["is_admin"] = user.Role == "admin"
 
-		// 🔹 2. Cek X-API-Key
-		if apiKeyHeader != "" {
-			var apiKey models.ApiKey
-			if err := config.DB.Where("key = ? AND is_active = ?", apiKeyHeader, true).First(&apiKey).Error; err != nil {
-				if err == gorm.ErrRecordNotFound {
-					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-						"error": "Invalid or inactive API key",
-					})
-				}
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Internal server error",
-				})
+		// An impersonation token dies with the admin's account or role.
+		if actorID := claims.ActorID(); actorID != 0 {
+			actor, authErr := freshUser(ctx, actorID, "invalid_token")
+			if authErr != nil {
+				return nil, authErr
 			}
+			if actor.Role != "admin" {
+				return nil, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "Impersonating admin is no longer an admin", challenge: "invalid_token"}
+			}
+		}
+	}
 
-			c.Locals("clientID", apiKey.Client)
-			c.Locals("scope", apiKey.Scope)
-			c.Locals("userID", apiKey.UserID)
-			c.Locals("authType", "APIKey")
+	return claims, nil
+}
 
-			return c.Next()
+// freshUser loads the user for WithFreshUserCheck. Deactivated accounts get
+// the same answer as deleted ones; only admins can tell them apart.
+func freshUser(ctx context.Context, userID uint, challenge string) (models.User, *authError) {
+	user, err := services.FindUserByID(ctx, userID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return models.User{}, errInternalAuth
+	}
+	if err != nil || !user.IsActive {
+		return models.User{}, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "User no longer exists", challenge: challenge}
+	}
+	return user, nil
+}
+
+func checkAPIKey(ctx context.Context, rawKey string, options authOptions) (models.ApiKey, *authError) {
+	apiKey, err := services.FindActiveApiKey(ctx, rawKey)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.ApiKey{}, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "Invalid or inactive API key"}
 		}
+		return models.ApiKey{}, errInternalAuth
+	}
 
-		// 🔹 Kalau dua-duanya kosong
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Missing authentication (JWT or API Key)",
-		})
+	if apiKey.IsExpired() {
+		return models.ApiKey{}, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "API key has expired"}
+	}
+
+	// A key for a client whose audience is served elsewhere is refused, as
+	// that client's access tokens would be.
+	if !utils.ClientAccepted(apiKey.Client) {
+		return models.ApiKey{}, &authError{status: fiber.StatusUnauthorized, code: utils.CodeUnauthorized, message: "API key is not valid for this service"}
+	}
+
+	if options.freshUserCheck {
+		if _, authErr := freshUser(ctx, apiKey.UserID, ""); authErr != nil {
+			return models.ApiKey{}, authErr
+		}
+	}
+
+	return apiKey, nil
+}
+
+func setJWTLocals(c *fiber.Ctx, claims *utils.Claims) {
+	// Store user information in context
+	c.Locals("userID", claims.UserID)
+	c.Locals("tenantID", claims.TenantID())
+	c.Locals("role", claims.Role)
+	// As of token issue unless WithFreshUserCheck reloaded them.
+	c.Locals("emailVerified", claims.EmailVerified())
+	c.Locals("isAdmin", claims.IsAdmin())
+	if actorID := claims.ActorID(); actorID != 0 {
+		// The admin impersonating userID; see RejectImpersonation.
+		c.Locals("actorID", actorID)
+	}
+	c.Locals(utils.ClaimsLocalsKey, claims)
+	c.Locals("authType", "JWT")
+}
+
+// ApiKeyRateLimitStore counts requests per API key across every route behind
+// AuthMiddleware. Replace it at startup with a shared backend to enforce the
+// limits across instances.
+var ApiKeyRateLimitStore utils.RateLimitStore = utils.NewMemoryRateLimitStore(time.Minute)
+
+// apiKeyRateLimited counts the request against the key's per-minute limit, or
+// defaultLimit (API_KEY_RATE_LIMIT) when the key has none. A limit of 0 means
+// unlimited.
+func apiKeyRateLimited(apiKey models.ApiKey, defaultLimit int) (bool, time.Time) {
+	limit := apiKey.RateLimit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit <= 0 {
+		return false, time.Time{}
+	}
+
+	count, resetAt := ApiKeyRateLimitStore.Increment(fmt.Sprintf("api_key:%d", apiKey.ID), time.Minute)
+	if count <= limit {
+		return false, time.Time{}
+	}
+	utils.ApiKeyRateLimitedTotal.Inc()
+	return true, resetAt
+}
+
+func setAPIKeyLocals(c *fiber.Ctx, apiKey models.ApiKey) {
+	c.Locals("clientID", apiKey.Client)
+	c.Locals("scope", apiKey.Scope)
+	c.Locals("userID", apiKey.UserID)
+	c.Locals("tenantID", apiKey.TenantID)
+	c.Locals("authType", "APIKey")
+}
+
+// invalidJWTError tells clients whether to refresh (token_expired) or to
+// authenticate again (token_malformed, token_invalid).
+func invalidJWTError(err error) *authError {
+	authErr := &authError{status: fiber.StatusUnauthorized, code: utils.CodeTokenInvalid, message: "Invalid JWT", challenge: "invalid_token"}
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		authErr.code, authErr.message = utils.CodeTokenExpired, "JWT has expired"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		authErr.code, authErr.message = utils.CodeTokenMalformed, "Malformed JWT"
+	case errors.Is(err, utils.ErrAlgNone):
+		authErr.message = "Unsigned JWT (alg none) is not accepted"
+	}
+	return authErr
+}
+
+// setBearerChallenge sets the RFC 6750 WWW-Authenticate header. errorCode is
+// left out when the request carried no credentials at all.
+func setBearerChallenge(c *fiber.Ctx, errorCode string) {
+	challenge := `Bearer realm="api"`
+	if errorCode != "" {
+		challenge += `, error="` + errorCode + `"`
 	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
 }
@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"jwt-poc/internal/testdb"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func protectedApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/", AuthMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestAuthMiddlewareApiKeyExpiry(t *testing.T) {
+	testdb.Open(t)
+	user := testdb.CreateUser(t, "alice")
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      int
+	}{
+		{"expired", &past, fiber.StatusUnauthorized},
+		{"not expired", &future, fiber.StatusOK},
+		{"never expires", nil, fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawKey, apiKey, err := services.CreateApiKey(context.Background(), user.ID, user.TenantID, "cli", "", tt.expiresAt, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !apiKey.IsActive {
+				t.Fatal("new key is not active")
+			}
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set("api-key", rawKey)
+			resp, err := protectedApp().Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTrimsApiKeyHeader(t *testing.T) {
+	testdb.Open(t)
+	user := testdb.CreateUser(t, "alice")
+	rawKey, _, err := services.CreateApiKey(context.Background(), user.ID, user.TenantID, "cli", "", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"padded", "  " + rawKey + " ", fiber.StatusOK},
+		{"bearer scheme", "Bearer " + rawKey, fiber.StatusOK},
+		{"lowercase scheme", "apikey " + rawKey, fiber.StatusOK},
+		{"changed case", strings.ToUpper(rawKey), fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set("api-key", tt.header)
+			resp, err := protectedApp().Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTrustedIssuer(t *testing.T) {
+	testdb.Open(t)
+	secret := strings.Repeat("i", 32)
+	t.Setenv("JWT_TRUSTED_ISSUERS", `[{"issuer":"https://idp.example.com","alg":"HS256","secret":"`+secret+`","role":"user","tenant_id":7}]`)
+	if err := utils.LoadJWTConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "https://idp.example.com",
+		Subject:   "external-user",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/", AuthMiddleware(WithFreshUserCheck()), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"role": c.Locals("role"), "tenant_id": c.Locals("tenantID")})
+	})
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var identity struct {
+		Role     string `json:"role"`
+		TenantID uint   `json:"tenant_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "user" || identity.TenantID != 7 {
+		t.Errorf("identity = %+v, want role user in tenant 7", identity)
+	}
+}
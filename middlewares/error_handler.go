@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"errors"
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorHandler renders errors that escape handlers, including panics converted by
+// the recover middleware, in the same JSON shape the handlers use.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return utils.ErrorResponse(c, fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message)
+	}
+
+	return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+}
+
+// codeForStatus maps the statuses fiber and the middlewares raise to their
+// codes. Anything else gets the generic code of its class.
+func codeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return utils.CodeBadRequest
+	case fiber.StatusUnauthorized:
+		return utils.CodeUnauthorized
+	case fiber.StatusForbidden:
+		return utils.CodeForbidden
+	case fiber.StatusNotFound:
+		return utils.CodeNotFound
+	case fiber.StatusConflict:
+		return utils.CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return utils.CodePayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return utils.CodeTooManyRequests
+	case fiber.StatusRequestTimeout, fiber.StatusGatewayTimeout:
+		return utils.CodeTimeout
+	}
+	if status >= fiber.StatusInternalServerError {
+		return utils.CodeInternalError
+	}
+	return utils.CodeBadRequest
+}
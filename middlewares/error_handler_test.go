@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"jwt-poc/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandlerCodes(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{fiber.StatusNotFound, utils.CodeNotFound},
+		{fiber.StatusMethodNotAllowed, utils.CodeBadRequest},
+		{fiber.StatusRequestTimeout, utils.CodeTimeout},
+		{fiber.StatusInternalServerError, utils.CodeInternalError},
+		{fiber.StatusNotImplemented, utils.CodeInternalError},
+		{fiber.StatusServiceUnavailable, utils.CodeInternalError},
+		{fiber.StatusGatewayTimeout, utils.CodeTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/", func(c *fiber.Ctx) error {
+				return fiber.NewError(tt.status)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			var body struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.want {
+				t.Errorf("code = %q, want %q", body.Error.Code, tt.want)
+			}
+		})
+	}
+}
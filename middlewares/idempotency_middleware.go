@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxIdempotencyKeyLength = 255
+
+var idempotencyKeyTTL = 24 * time.Hour
+
+// SetIdempotencyKeyTTL applies IDEMPOTENCY_KEY_TTL once at startup, before
+// Idempotency is created.
+func SetIdempotencyKeyTTL(ttl time.Duration) {
+	idempotencyKeyTTL = ttl
+}
+
+// Idempotency replays the stored response when a request is retried with the
+// same Idempotency-Key header, instead of running the handler again. Keys are
+// scoped to the route and, when authenticated, the caller, and are kept for
+// IDEMPOTENCY_KEY_TTL (24h by default). Requests without the header pass
+// through unchanged. 5xx responses are not stored, so those can be retried.
+func Idempotency() fiber.Handler {
+	ttl := idempotencyKeyTTL
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, utils.CodeBadRequest, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		}
+
+		scope := c.Method() + " " + c.Route().Path
+		if userID, ok := c.Locals("userID").(uint); ok {
+			scope = fmt.Sprintf("%s user:%d", scope, userID)
+		}
+		sum := sha256.Sum256(c.Body())
+
+		record, replay, err := services.BeginIdempotentRequest(c.UserContext(), scope, key, hex.EncodeToString(sum[:]), ttl)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyMismatch):
+			return utils.ErrorResponse(c, fiber.StatusUnprocessableEntity, utils.CodeConflict, "Idempotency-Key was already used with a different request")
+		case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+			return utils.ErrorResponse(c, fiber.StatusConflict, utils.CodeConflict, "A request with this Idempotency-Key is still in progress")
+		case err != nil:
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+		}
+
+		if replay {
+			c.Set("Idempotent-Replayed", "true")
+			if record.ContentType != "" {
+				c.Set(fiber.HeaderContentType, record.ContentType)
+			}
+			return c.Status(record.StatusCode).Send(record.Body)
+		}
+
+		// The key must be settled even when the request ran out of time.
+		ctx := context.WithoutCancel(c.UserContext())
+		if err := c.Next(); err != nil {
+			if releaseErr := services.ReleaseIdempotencyKey(ctx, &record); releaseErr != nil {
+				log.Println("failed to release idempotency key:", releaseErr)
+			}
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			err = services.ReleaseIdempotencyKey(ctx, &record)
+		} else {
+			body := append([]byte(nil), c.Response().Body()...)
+			err = services.CompleteIdempotentRequest(ctx, &record, status, string(c.Response().Header.ContentType()), body)
+		}
+		if err != nil {
+			log.Println("failed to store idempotency key:", err)
+		}
+		return nil
+	}
+}
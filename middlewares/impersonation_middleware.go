@@ -0,0 +1,19 @@
+package middlewares
+
+import (
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RejectImpersonation must run after AuthMiddleware. It keeps an admin acting
+// as a user away from the user's credentials (password, email, 2FA, API keys),
+// which would outlive the impersonation token.
+func RejectImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, impersonated := c.Locals("actorID").(uint); impersonated {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Not allowed while impersonating a user")
+		}
+		return c.Next()
+	}
+}
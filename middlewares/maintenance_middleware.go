@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"jwt-poc/config"
+	"jwt-poc/utils"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The default allowed paths keep logging in and refreshing working, so reads go
+// on once access tokens expire and an admin can still log in to end
+// maintenance.
+var maintenanceConfig = config.MaintenanceConfig{
+	BlockedMethods: []string{fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete},
+	AllowPaths:     []string{"/api/auth/login", "/api/auth/2fa", "/api/auth/refresh", "/api/auth/logout"},
+}
+
+// SetMaintenanceConfig applies MAINTENANCE_BLOCKED_METHODS and
+// MAINTENANCE_ALLOW_PATHS once at startup, before MaintenanceMiddleware is
+// created.
+func SetMaintenanceConfig(cfg config.MaintenanceConfig) {
+	maintenanceConfig = cfg
+}
+
+// MaintenanceMiddleware answers 503 to writes while maintenance mode is on and
+// lets reads through. MAINTENANCE_BLOCKED_METHODS lists the blocked methods
+// (POST, PUT, PATCH and DELETE by default). Paths starting with an entry of
+// MAINTENANCE_ALLOW_PATHS, the login, 2FA, refresh and logout endpoints by
+// default, stay writable; the maintenance endpoint always does, so the mode
+// can be switched off again.
+func MaintenanceMiddleware() fiber.Handler {
+	blocked := maintenanceConfig.BlockedMethods
+	allowed := append(slices.Clone(maintenanceConfig.AllowPaths), "/api/admin/maintenance")
+
+	return func(c *fiber.Ctx) error {
+		if !utils.MaintenanceMode() || !slices.Contains(blocked, c.Method()) {
+			return c.Next()
+		}
+		for _, prefix := range allowed {
+			if strings.HasPrefix(c.Path(), prefix) {
+				return c.Next()
+			}
+		}
+
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, utils.CodeMaintenance, "Service is in read-only maintenance mode, please try again later")
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"jwt-poc/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MetricsMiddleware records handler latency labelled with the route pattern
+// rather than the raw path, so IDs in URLs don't blow up label cardinality.
+func MetricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		}
+
+		// Fiber reuses the method's backing buffer, and label values are kept.
+		method := strings.Clone(c.Method())
+		utils.RequestDuration.
+			WithLabelValues(method, c.Route().Path, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+		return err
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"jwt-poc/services"
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission must run after AuthMiddleware. The caller needs permission
+// through their role (ROLE_PERMISSIONS) or a direct grant. Like RequireRole it
+// rejects API-key requests, which are limited by the key's scope instead; see
+// RequireScope.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(uint)
+		if !ok || c.Locals("authType") == "APIKey" {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Insufficient permissions")
+		}
+
+		role, _ := c.Locals("role").(string)
+		granted, err := services.HasPermission(c.UserContext(), userID, role, permission)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+		}
+		if !granted {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Insufficient permissions")
+		}
+		return c.Next()
+	}
+}
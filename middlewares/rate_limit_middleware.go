@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"jwt-poc/utils"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimitMiddleware allows limit requests per key within window and answers
+// 429 with a Retry-After header once the limit is exceeded.
+func RateLimitMiddleware(store utils.RateLimitStore, limit int, window time.Duration, keyFunc func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		count, resetAt := store.Increment(keyFunc(c), window)
+		if count > limit {
+			return tooManyRequests(c, resetAt)
+		}
+
+		return c.Next()
+	}
+}
+
+func tooManyRequests(c *fiber.Ctx, resetAt time.Time) error {
+	retryAfter := int(math.Ceil(time.Until(resetAt).Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return utils.ErrorResponse(c, fiber.StatusTooManyRequests, utils.CodeTooManyRequests, "Too many requests, please try again later")
+}
+
+// LoginRateLimitMiddleware limits login attempts per IP and username, defaulting
+// to 5 attempts per minute (LOGIN_RATE_LIMIT, LOGIN_RATE_WINDOW; see
+// SetAuthConfig).
+func LoginRateLimitMiddleware() fiber.Handler {
+	limit := authConfig.LoginRateLimit
+	window := authConfig.LoginRateWindow
+
+	return RateLimitMiddleware(utils.NewMemoryRateLimitStore(window), limit, window, func(c *fiber.Ctx) string {
+		var body struct {
+			Username string `json:"username"`
+		}
+		_ = c.BodyParser(&body)
+		return c.IP() + "|" + strings.ToLower(body.Username)
+	})
+}
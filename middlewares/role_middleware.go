@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole must run after AuthMiddleware. API-key requests carry no role and
+// are therefore always rejected.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, allowed := range roles {
+			if role == allowed {
+				return c.Next()
+			}
+		}
+
+		return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "Insufficient permissions")
+	}
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope must run after AuthMiddleware. For API-key requests the key's
+// scope is treated as a space-delimited set (as in OAuth) and must contain every
+// required scope. JWT requests are passed through unchanged: users are governed
+// by their role, so combine this with RequireRole where users need restricting.
+//
+// Scopes are resource:action, e.g. profile:read or apikeys:write; a key with
+// an empty scope can only reach routes that require none, such as /auth/me.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("authType") != "APIKey" {
+			return c.Next()
+		}
+
+		scope, _ := c.Locals("scope").(string)
+		if !utils.ScopeCovers(scope, scopes...) {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeForbidden, "API key scope does not allow this operation")
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"fmt"
+	"jwt-poc/config"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type securityHeader struct {
+	name, value string
+}
+
+var securityHeadersConfig = config.SecurityHeadersConfig{
+	ContentTypeOptions: "nosniff",
+	FrameOptions:       "DENY",
+	ReferrerPolicy:     "no-referrer",
+}
+
+// SetSecurityHeaders applies the SECURITY_HEADER_* and HSTS_* settings once at
+// startup, before SecurityHeadersMiddleware is created.
+func SetSecurityHeaders(cfg config.SecurityHeadersConfig) {
+	securityHeadersConfig = cfg
+}
+
+// SecurityHeadersMiddleware sets X-Content-Type-Options, X-Frame-Options and
+// Referrer-Policy on every response, with the values of
+// SECURITY_HEADER_CONTENT_TYPE_OPTIONS, SECURITY_HEADER_FRAME_OPTIONS and
+// SECURITY_HEADER_REFERRER_POLICY; "off" leaves a header out.
+//
+// Strict-Transport-Security is sent only when HSTS_MAX_AGE is set and the
+// request came over TLS, directly or per X-Forwarded-Proto from the proxy.
+// HSTS_INCLUDE_SUBDOMAINS extends it to subdomains.
+func SecurityHeadersMiddleware() fiber.Handler {
+	cfg := securityHeadersConfig
+	var headers []securityHeader
+	for _, h := range []securityHeader{
+		{fiber.HeaderXContentTypeOptions, cfg.ContentTypeOptions},
+		{fiber.HeaderXFrameOptions, cfg.FrameOptions},
+		{fiber.HeaderReferrerPolicy, cfg.ReferrerPolicy},
+	} {
+		if !strings.EqualFold(h.value, "off") {
+			headers = append(headers, h)
+		}
+	}
+
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge/time.Second))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		// Set before the handler runs so error responses carry them too.
+		for _, h := range headers {
+			c.Set(h.name, h.value)
+		}
+		if hsts != "" && c.Protocol() == "https" {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"jwt-poc/config"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    func(cfg *config.SecurityHeadersConfig)
+		proto  string
+		status int
+		want   map[string]string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{
+				fiber.HeaderXContentTypeOptions:     "nosniff",
+				fiber.HeaderXFrameOptions:           "DENY",
+				fiber.HeaderReferrerPolicy:          "no-referrer",
+				fiber.HeaderStrictTransportSecurity: "",
+			},
+		},
+		{
+			name:   "on error responses",
+			status: fiber.StatusNotFound,
+			want: map[string]string{
+				fiber.HeaderXContentTypeOptions: "nosniff",
+				fiber.HeaderXFrameOptions:       "DENY",
+			},
+		},
+		{
+			name: "overridden and off",
+			set: func(cfg *config.SecurityHeadersConfig) {
+				cfg.FrameOptions = "SAMEORIGIN"
+				cfg.ReferrerPolicy = "off"
+			},
+			want: map[string]string{
+				fiber.HeaderXContentTypeOptions: "nosniff",
+				fiber.HeaderXFrameOptions:       "SAMEORIGIN",
+				fiber.HeaderReferrerPolicy:      "",
+			},
+		},
+		{
+			name: "HSTS not sent over http",
+			set:  func(cfg *config.SecurityHeadersConfig) { cfg.HSTSMaxAge = 24 * time.Hour },
+			want: map[string]string{fiber.HeaderStrictTransportSecurity: ""},
+		},
+		{
+			name: "HSTS behind a TLS proxy",
+			set: func(cfg *config.SecurityHeadersConfig) {
+				cfg.HSTSMaxAge = 24 * time.Hour
+				cfg.HSTSIncludeSubdomains = true
+			},
+			proto: "https",
+			want:  map[string]string{fiber.HeaderStrictTransportSecurity: "max-age=86400; includeSubDomains"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaults := securityHeadersConfig
+			t.Cleanup(func() { SetSecurityHeaders(defaults) })
+			cfg := defaults
+			if tt.set != nil {
+				tt.set(&cfg)
+			}
+			SetSecurityHeaders(cfg)
+			status := tt.status
+			if status == 0 {
+				status = fiber.StatusOK
+			}
+
+			app := fiber.New()
+			app.Use(SecurityHeadersMiddleware())
+			app.Get("/", func(c *fiber.Ctx) error {
+				if status != fiber.StatusOK {
+					return fiber.NewError(status)
+				}
+				return c.SendStatus(status)
+			})
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.proto != "" {
+				req.Header.Set(fiber.HeaderXForwardedProto, tt.proto)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, status)
+			}
+			for name, want := range tt.want {
+				if got := resp.Header.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
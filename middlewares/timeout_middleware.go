@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"jwt-poc/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var requestTimeout = 10 * time.Second
+
+// SetRequestTimeout applies REQUEST_TIMEOUT once at startup, before
+// TimeoutMiddleware is created. 0 turns the deadline off.
+func SetRequestTimeout(timeout time.Duration) {
+	requestTimeout = timeout
+}
+
+// TimeoutMiddleware puts the request timeout deadline on c.UserContext().
+// Queries run with DB.WithContext(c.UserContext()) are cancelled once it
+// passes, and the request is answered with 504 instead of whatever error the
+// handler produced from the cancelled query.
+func TimeoutMiddleware() fiber.Handler {
+	timeout := requestTimeout
+
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+		// Handlers turn query errors into 500s, so only server errors are
+		// replaced; any other response that was produced is kept.
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+		if status < fiber.StatusInternalServerError && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		return utils.ErrorResponse(c, fiber.StatusGatewayTimeout, utils.CodeTimeout, "Request timed out")
+	}
+}
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTimeoutMiddlewareDeadline(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		wantDeadline bool
+	}{
+		{"enabled", time.Second, true},
+		{"zero turns it off", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRequestTimeout(tt.timeout)
+			t.Cleanup(func() { SetRequestTimeout(10 * time.Second) })
+
+			app := fiber.New()
+			hasDeadline := false
+			app.Get("/", TimeoutMiddleware(), func(c *fiber.Ctx) error {
+				_, hasDeadline = c.UserContext().Deadline()
+				return c.SendStatus(fiber.StatusOK)
+			})
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+			}
+			if hasDeadline != tt.wantDeadline {
+				t.Errorf("deadline set = %t, want %t", hasDeadline, tt.wantDeadline)
+			}
+		})
+	}
+}
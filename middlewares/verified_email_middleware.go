@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"errors"
+	"jwt-poc/services"
+	"jwt-poc/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// RequireVerifiedEmail must run after AuthMiddleware and can be chained with
+// RequireRole. It loads the user on every request so a verification done after
+// the token was issued counts immediately, and it applies to API-key requests
+// through the key's owner.
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(uint)
+		if !ok {
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Unauthorized access")
+		}
+
+		user, err := services.FindUserByID(c.UserContext(), userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "User no longer exists")
+			}
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, utils.CodeInternalError, "Internal server error")
+		}
+
+		if !user.EmailVerified {
+			return utils.ErrorResponse(c, fiber.StatusForbidden, utils.CodeEmailNotVerified, "email not verified")
+		}
+		return c.Next()
+	}
+}
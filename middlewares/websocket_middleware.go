@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"jwt-poc/utils"
+	"strings"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebSocketTokenProtocol is the subprotocol a browser offers ahead of its JWT,
+// as in new WebSocket(url, ["access_token", token]), since it can't set an
+// Authorization header on the upgrade request.
+const WebSocketTokenProtocol = "access_token"
+
+// WebSocketAuth authenticates an upgrade request by the JWT in the
+// access_token query parameter or the Sec-WebSocket-Protocol header. The
+// token is checked like AuthMiddleware with WithFreshUserCheck, as the
+// connection outlives a normal request. Failures get a 401 before upgrading.
+func WebSocketAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return utils.ErrorResponse(c, fiber.StatusUpgradeRequired, utils.CodeBadRequest, "WebSocket upgrade required")
+		}
+
+		tokenString := c.Query("access_token")
+		if tokenString == "" {
+			tokenString = protocolToken(c.Get(fiber.HeaderSecWebSocketProtocol))
+		}
+		if tokenString == "" {
+			setBearerChallenge(c, "")
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, utils.CodeUnauthorized, "Missing JWT")
+		}
+
+		claims, authErr := checkJWT(c.UserContext(), tokenString, authOptions{freshUserCheck: true})
+		if authErr != nil {
+			return authErr.send(c)
+		}
+		setJWTLocals(c, claims)
+		return c.Next()
+	}
+}
+
+// protocolToken returns the value offered after WebSocketTokenProtocol in a
+// Sec-WebSocket-Protocol header such as "access_token, <jwt>".
+func protocolToken(header string) string {
+	protocols := strings.Split(header, ",")
+	for i, protocol := range protocols[:len(protocols)-1] {
+		if strings.TrimSpace(protocol) == WebSocketTokenProtocol {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+	return ""
+}
@@ -1,9 +1,31 @@
 package models
 
+import "time"
+
+// ApiKey stores only a SHA-256 hash of the key plus a short plaintext prefix used
+// to find candidate rows. Keys issued before hashing were stored verbatim in a
+// `key` primary-key column; those rows cannot be matched anymore and must be
+// re-issued through POST /api/apikeys (or hashed into key_hash/prefix by a
+// one-off script) before the old column is dropped.
 type ApiKey struct {
-	Key      string `gorm:"primaryKey;not null" json:"key"`
-	UserID   uint   `gorm:"not null" json:"user_id"`
-	Client   string `gorm:"not null" json:"client"`
-	Scope    string
-	IsActive bool `gorm:"default:true" json:"is_active"`
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Prefix    string `gorm:"index;not null" json:"prefix"`
+	KeyHash   string `gorm:"unique;not null" json:"-"`
+	UserID    uint   `gorm:"not null" json:"user_id"`
+	User      *User  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	TenantID  uint   `gorm:"not null;default:0;index" json:"tenant_id"`
+	Client    string `gorm:"not null" json:"client"`
+	Scope     string
+	IsActive  bool       `gorm:"default:true" json:"is_active"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// RateLimit is in requests per minute; 0 falls back to API_KEY_RATE_LIMIT.
+	RateLimit int `gorm:"not null;default:0" json:"rate_limit"`
+	// LastUsedAt is nil for keys never used, and otherwise lags by up to
+	// API_KEY_LAST_USED_INTERVAL; see services.TouchApiKey.
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// IsExpired treats a nil ExpiresAt as a key that never expires.
+func (k ApiKey) IsExpired() bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())
 }
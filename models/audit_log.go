@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditLog is an append-only record of a security-sensitive event. Nothing in
+// the application updates or deletes these rows. ActorID is 0 when the actor is
+// unknown, e.g. a failed login for a username that doesn't exist.
+// ImpersonatorID is the admin behind ActorID when the event came from an
+// impersonation token, and 0 otherwise.
+type AuditLog struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	ActorID        uint            `gorm:"not null;index" json:"actor_id"`
+	ImpersonatorID uint            `gorm:"not null;default:0;index" json:"impersonator_id,omitempty"`
+	TenantID       uint            `gorm:"not null;default:0;index" json:"tenant_id"`
+	Action         string          `gorm:"not null;index" json:"action"`
+	Target         string          `json:"target"`
+	IP             string          `json:"ip"`
+	Metadata       json.RawMessage `json:"metadata,omitempty" swaggertype:"object"`
+	CreatedAt      time.Time       `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyKey stores the response to a request sent with an
+// Idempotency-Key header. StatusCode is 0 while the request is in progress.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Scope       string    `gorm:"not null;uniqueIndex:idx_idempotency_scope_key" json:"scope"`
+	Key         string    `gorm:"not null;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	RequestHash string    `gorm:"not null" json:"-"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"-"`
+	Body        []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+}
@@ -2,9 +2,25 @@ package models
 
 import "time"
 
+// RefreshToken stores only a SHA-256 hash of the token handed to the client, in
+// the original `token` column. Rows written before hashing hold plaintext that
+// no presented token hashes to, so those sessions have to log in again and the
+// rows are purged once they expire.
 type RefreshToken struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	UserID     uint      `gorm:"not null" json:"user_id"`
-	Token      string    `gorm:"unique;not null" json:"token"`
-	ExpiryDate time.Time `gorm:"not null" json:"expiry_date"`
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"not null" json:"user_id"`
+	User      *User  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	TokenHash string `gorm:"column:token;unique;not null" json:"-"`
+	// ReplacedBy is the hash of the token this one was rotated into.
+	ReplacedBy string     `json:"-"`
+	ExpiryDate time.Time  `gorm:"not null" json:"expiry_date"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Device     string     `json:"device"`
+	// Client picks the audience of the access tokens; see JWT_CLIENT_AUDIENCES.
+	Client string `json:"client,omitempty"`
+	// UserAgentHash and IPHash fingerprint the client the token was issued to.
+	UserAgentHash string    `json:"-"`
+	IPHash        string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsedAt    time.Time `json:"last_used_at"`
 }
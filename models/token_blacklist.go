@@ -0,0 +1,8 @@
+package models
+
+import "time"
+
+type TokenBlacklist struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
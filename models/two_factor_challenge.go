@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// TwoFactorChallenge is handed out by a password login for a user with TOTP
+// enabled and exchanged for real tokens once the code has been checked.
+type TwoFactorChallenge struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Client    string    `json:"client"`
+	Token     string    `gorm:"unique;not null" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+}
@@ -1,9 +1,25 @@
 package models
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User names and emails are unique within a tenant.
 type User struct {
-	ID           uint   `gorm:"primaryKey" json:"id"`
-	Username     string `gorm:"unique;not null" json:"username"`
-	Email        string `gorm:"unique;not null" json:"email"`
-	PasswordHash string `gorm:"not null" json:"-"`
-	Role         string `gorm:"not null;default:'user'" json:"role"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Username       string         `gorm:"not null;uniqueIndex:idx_users_tenant_username,priority:2" json:"username"`
+	Email          string         `gorm:"not null;uniqueIndex:idx_users_tenant_email,priority:2" json:"email"`
+	TenantID       uint           `gorm:"not null;default:0;index;uniqueIndex:idx_users_tenant_username,priority:1;uniqueIndex:idx_users_tenant_email,priority:1" json:"tenant_id"`
+	PasswordHash   string         `gorm:"not null" json:"-"`
+	Role           string         `gorm:"not null;default:'user'" json:"role"`
+	EmailVerified  bool           `gorm:"not null;default:false" json:"email_verified"`
+	PendingEmail   string         `json:"pending_email,omitempty"`
+	FailedAttempts int            `gorm:"not null;default:0" json:"-"`
+	LockedUntil    *time.Time     `json:"-"`
+	TOTPSecret     string         `json:"-"`
+	TOTPEnabled    bool           `gorm:"not null;default:false" json:"totp_enabled"`
+	IsActive       bool           `gorm:"not null;default:true" json:"is_active"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
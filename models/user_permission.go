@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserPermission grants one permission to a user on top of those of their
+// role; see utils.LoadRolePermissions for the permission format.
+type UserPermission struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_user_permission" json:"user_id"`
+	User       *User     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Permission string    `gorm:"not null;uniqueIndex:idx_user_permission" json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
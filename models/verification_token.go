@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type VerificationToken struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	User   *User  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Token  string `gorm:"unique;not null" json:"-"`
+	// Email is the new address for an email change; empty when verifying the
+	// current one.
+	Email     string    `json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrScopeExceeded keeps an API key from issuing a key with more access than
+// its own.
+var ErrScopeExceeded = errors.New("scope exceeds the caller's API key scope")
+
+// CreateApiKey issues a key. rateLimit is in requests per minute; 0 uses
+// API_KEY_RATE_LIMIT.
+func CreateApiKey(ctx context.Context, userID, tenantID uint, client, scope string, expiresAt *time.Time, rateLimit int) (rawKey string, apiKey models.ApiKey, err error) {
+	return createApiKey(config.DB.WithContext(ctx), models.ApiKey{
+		UserID:    userID,
+		TenantID:  tenantID,
+		Client:    client,
+		Scope:     scope,
+		ExpiresAt: expiresAt,
+		RateLimit: rateLimit,
+	})
+}
+
+// createApiKey generates a new key with the settings of template.
+func createApiKey(db *gorm.DB, template models.ApiKey) (rawKey string, apiKey models.ApiKey, err error) {
+	rawKey, err = utils.GenerateApiKey()
+	if err != nil {
+		return "", models.ApiKey{}, err
+	}
+
+	apiKey = models.ApiKey{
+		Prefix:    utils.ApiKeyPrefix(rawKey),
+		KeyHash:   utils.HashApiKey(rawKey),
+		UserID:    template.UserID,
+		TenantID:  template.TenantID,
+		Client:    template.Client,
+		Scope:     template.Scope,
+		IsActive:  true,
+		ExpiresAt: template.ExpiresAt,
+		RateLimit: template.RateLimit,
+	}
+
+	if err := db.Create(&apiKey).Error; err != nil {
+		return "", models.ApiKey{}, err
+	}
+
+	return rawKey, apiKey, nil
+}
+
+// FindActiveApiKey returns gorm.ErrRecordNotFound when no active key matches.
+func FindActiveApiKey(ctx context.Context, rawKey string) (models.ApiKey, error) {
+	prefix := utils.ApiKeyPrefix(rawKey)
+	if prefix == "" {
+		return models.ApiKey{}, gorm.ErrRecordNotFound
+	}
+
+	var candidates []models.ApiKey
+	if err := config.DB.WithContext(ctx).Where("prefix = ? AND is_active = ?", prefix, true).Find(&candidates).Error; err != nil {
+		return models.ApiKey{}, err
+	}
+
+	hash := utils.HashApiKey(rawKey)
+	for _, candidate := range candidates {
+		if subtle.ConstantTimeCompare([]byte(candidate.KeyHash), []byte(hash)) == 1 {
+			return candidate, nil
+		}
+	}
+
+	return models.ApiKey{}, gorm.ErrRecordNotFound
+}
+
+// TouchApiKey records that apiKey authenticated a request, at most once per
+// interval: a key used within interval is skipped without a query, and the
+// conditional update keeps concurrent requests, including those on other
+// instances, from writing it again. Failures are logged, never returned, so
+// they can't fail the request.
+func TouchApiKey(ctx context.Context, apiKey models.ApiKey, interval time.Duration) {
+	now := time.Now()
+	staleBefore := now.Add(-interval)
+	if apiKey.LastUsedAt != nil && apiKey.LastUsedAt.After(staleBefore) {
+		return
+	}
+
+	err := config.DB.WithContext(context.WithoutCancel(ctx)).Model(&models.ApiKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at <= ?)", apiKey.ID, staleBefore).
+		Update("last_used_at", now).Error
+	if err != nil {
+		log.Printf("failed to record use of api key %d: %v", apiKey.ID, err)
+	}
+}
+
+// ListApiKeys returns userID's keys in tenantID, newest first. Revoked keys are
+// included unless activeOnly is set.
+func ListApiKeys(ctx context.Context, userID, tenantID uint, activeOnly bool) ([]models.ApiKey, error) {
+	query := config.DB.WithContext(ctx).Where("user_id = ? AND tenant_id = ?", userID, tenantID)
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+
+	apiKeys := []models.ApiKey{}
+	err := query.Order("id DESC").Find(&apiKeys).Error
+	return apiKeys, err
+}
+
+func RevokeApiKey(ctx context.Context, id, userID, tenantID uint, isAdmin bool) error {
+	apiKey, err := findOwnedApiKey(ctx, id, userID, tenantID, isAdmin)
+	if err != nil {
+		return err
+	}
+
+	return config.DB.WithContext(ctx).Model(&apiKey).Update("is_active", false).Error
+}
+
+// RotateApiKey deactivates an active key and issues a replacement with the same
+// owner, client, scope and expiry. A caller authenticated by an API key passes
+// its scope as callerScope and gets ErrScopeExceeded for a key with a scope
+// wider than its own; JWT callers pass nil.
+func RotateApiKey(ctx context.Context, id, userID, tenantID uint, isAdmin bool, callerScope *string) (rawKey string, apiKey models.ApiKey, err error) {
+	oldKey, err := findOwnedApiKey(ctx, id, userID, tenantID, isAdmin)
+	if err != nil {
+		return "", models.ApiKey{}, err
+	}
+	if !oldKey.IsActive {
+		return "", models.ApiKey{}, gorm.ErrRecordNotFound
+	}
+	if callerScope != nil && !utils.ScopeCovers(*callerScope, strings.Fields(oldKey.Scope)...) {
+		return "", models.ApiKey{}, ErrScopeExceeded
+	}
+
+	err = Transaction(ctx, func(tx Stores) error {
+		if err := tx.DB.Model(&oldKey).Update("is_active", false).Error; err != nil {
+			return err
+		}
+
+		rawKey, apiKey, err = createApiKey(tx.DB, oldKey)
+		return err
+	})
+	if err != nil {
+		return "", models.ApiKey{}, err
+	}
+	return rawKey, apiKey, nil
+}
+
+// findOwnedApiKey hides keys owned by other users behind gorm.ErrRecordNotFound
+// unless the caller is an admin. Admins only see keys of their own tenant.
+func findOwnedApiKey(ctx context.Context, id, userID, tenantID uint, isAdmin bool) (models.ApiKey, error) {
+	query := config.DB.WithContext(ctx).Where("id = ? AND tenant_id = ?", id, tenantID)
+	if !isAdmin {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var apiKey models.ApiKey
+	err := query.First(&apiKey).Error
+	return apiKey, err
+}
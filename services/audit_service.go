@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"log"
+)
+
+const (
+	AuditLoginSuccess         = "login.success"
+	AuditLoginFailure         = "login.failure"
+	AuditLogout               = "logout"
+	AuditPasswordChange       = "password.change"
+	AuditRoleChange           = "user.role_change"
+	AuditUserDeactivate       = "user.deactivate"
+	AuditUserReactivate       = "user.reactivate"
+	AuditUserImpersonate      = "user.impersonate"
+	AuditPermissionGrant      = "user.permission_grant"
+	AuditPermissionRevoke     = "user.permission_revoke"
+	AuditEmailChange          = "user.email_change"
+	AuditUserBulkImport       = "user.bulk_import"
+	AuditApiKeyCreate         = "api_key.create"
+	AuditApiKeyRevoke         = "api_key.revoke"
+	AuditApiKeyRotate         = "api_key.rotate"
+	AuditRefreshTokenReuse    = "refresh_token.reuse"
+	AuditRefreshTokenMismatch = "refresh_token.fingerprint_mismatch"
+	AuditRefreshTokenRevoke   = "refresh_token.admin_revoke"
+	AuditMaintenanceToggle    = "maintenance.toggle"
+)
+
+type AuditEvent struct {
+	Action  string
+	ActorID uint
+	// ImpersonatorID is set when ActorID is being impersonated.
+	ImpersonatorID uint
+	TenantID       uint
+	Target         string
+	IP             string
+	Metadata       map[string]any
+}
+
+// Audit records the event. Failures are logged and swallowed so a broken audit
+// table never fails the request that triggered the event. The write ignores
+// ctx's cancellation, so events of timed-out requests are still recorded.
+func Audit(ctx context.Context, event AuditEvent) {
+	entry := models.AuditLog{
+		ActorID:        event.ActorID,
+		ImpersonatorID: event.ImpersonatorID,
+		TenantID:       event.TenantID,
+		Action:         event.Action,
+		Target:         event.Target,
+		IP:             event.IP,
+	}
+	if event.Metadata != nil {
+		metadata, err := json.Marshal(event.Metadata)
+		if err != nil {
+			log.Printf("failed to encode audit metadata for %s: %v", event.Action, err)
+		} else {
+			entry.Metadata = metadata
+		}
+	}
+
+	if err := config.DB.WithContext(context.WithoutCancel(ctx)).Create(&entry).Error; err != nil {
+		log.Printf("failed to write audit log for %s: %v", event.Action, err)
+	}
+}
@@ -1,53 +1,438 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"jwt-poc/config"
 	"jwt-poc/models"
+	"jwt-poc/stores"
 	"jwt-poc/utils"
+	"log"
 	"time"
 
-	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
 )
 
-func GenerateAuthToken(user models.User) (accessToken string, refreshToken string, err error) {
-	accessToken, err = utils.GenerateAccessToken(user.ID, user.Role)
+// RefreshTokenTTL is how long a refresh token stays valid after it is issued.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrTokenReuse          = errors.New("token reuse detected")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrFingerprintMismatch = errors.New("refresh token was issued to a different client")
+)
+
+var sessionConfig = config.SessionConfig{RotationGrace: 10 * time.Second, MaxPerUser: 5}
+
+// SetSessionConfig applies REFRESH_ROTATION_GRACE, REFRESH_IDLE_TIMEOUT,
+// MAX_SESSIONS_PER_USER and REFRESH_TOKEN_BINDING_REVOKE once at startup;
+// config.Load has already checked them.
+func SetSessionConfig(cfg config.SessionConfig) {
+	sessionConfig = cfg
+}
+
+// AuthTokens is the result of a login or refresh. ActiveSessions counts the
+// user's live refresh tokens after the new one was issued.
+type AuthTokens struct {
+	AccessToken           string
+	RefreshToken          string
+	AccessTokenExpiresAt  time.Time
+	RefreshTokenExpiresAt time.Time
+	ActiveSessions        int64
+}
+
+// GenerateAuthToken issues an access token for client's audience and a
+// refresh token labelled with device. Once the user holds more than MAX_SESSIONS_PER_USER active refresh
+// tokens the oldest ones are evicted; 0 disables the limit. With
+// REFRESH_TOKEN_MODE=jwt the refresh token is a signed JWT instead; see
+// SetRefreshTokenMode.
+func GenerateAuthToken(ctx context.Context, user models.User, client, device string, fingerprint utils.ClientFingerprint) (tokens AuthTokens, err error) {
+	ctx, span := utils.Tracer.Start(ctx, "services.GenerateAuthToken", trace.WithAttributes(attribute.Int("user.id", int(user.ID))))
+	defer func() { endSpan(span, err) }()
+
+	if refreshTokenMode == RefreshTokenJWT {
+		return issueRefreshJWT(user, client, fingerprint)
+	}
+
+	err = Transaction(ctx, func(tx Stores) error {
+		var err error
+		tokens, err = issueAuthTokens(ctx, tx.Tokens, user, client, device, fingerprint)
+		return err
+	})
+	return tokens, err
+}
+
+// issueAuthTokens creates the refresh token and applies the session limit
+// through tokens, so callers can run it inside their own transaction.
+func issueAuthTokens(ctx context.Context, tokens stores.TokenStore, user models.User, client, device string, fingerprint utils.ClientFingerprint) (AuthTokens, error) {
+	now := time.Now()
+	accessToken, err := generateAccessToken(user, client)
 	if err != nil {
-		return "", "", err
+		return AuthTokens{}, err
 	}
 
-	refreshToken = uuid.New().String()
-	expiry := time.Now().Add(30 * 24 * time.Hour)
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return AuthTokens{}, err
+	}
 
 	refreshTokenModel := models.RefreshToken{
-		UserID:     user.ID,
-		Token:      refreshToken,
-		ExpiryDate: expiry,
+		UserID:        user.ID,
+		TokenHash:     utils.HashRefreshToken(refreshToken),
+		ExpiryDate:    now.Add(RefreshTokenTTL),
+		Device:        device,
+		Client:        client,
+		UserAgentHash: fingerprint.UserAgentHash,
+		IPHash:        fingerprint.IPHash,
+		LastUsedAt:    now,
+	}
+
+	if err := tokens.Create(ctx, &refreshTokenModel); err != nil {
+		return AuthTokens{}, err
+	}
+
+	activeSessions, err := enforceSessionLimit(ctx, tokens, user.ID)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	return AuthTokens{
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		AccessTokenExpiresAt:  now.Add(utils.AccessTokenTTL),
+		RefreshTokenExpiresAt: refreshTokenModel.ExpiryDate,
+		ActiveSessions:        activeSessions,
+	}, nil
+}
+
+func RefreshAndRevokeToken(ctx context.Context, oldRefreshToken string, fingerprint utils.ClientFingerprint) (_ AuthTokens, err error) {
+	ctx, span := utils.Tracer.Start(ctx, "services.RefreshAndRevokeToken")
+	defer func() { endSpan(span, err) }()
+
+	if refreshTokenMode == RefreshTokenJWT {
+		return refreshWithJWT(ctx, oldRefreshToken, fingerprint)
+	}
+
+	oldToken, err := FindRefreshToken(ctx, oldRefreshToken)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	bound := fingerprint.Matches(utils.ClientFingerprint{UserAgentHash: oldToken.UserAgentHash, IPHash: oldToken.IPHash})
+
+	// A rotated token being presented again means it leaked: kill the whole chain.
+	// The exception is a retry from the same client shortly after rotation whose
+	// response was lost.
+	if oldToken.RevokedAt != nil {
+		if bound {
+			tokens, ok, err := replayRotation(ctx, oldToken, fingerprint)
+			if err != nil {
+				return AuthTokens{}, err
+			}
+			if ok {
+				return tokens, nil
+			}
+		}
+		return AuthTokens{}, revokeReusedToken(ctx, oldToken)
+	}
+
+	now := time.Now()
+	if !oldToken.ExpiryDate.After(now) || idleExpired(oldToken, now) {
+		return AuthTokens{}, ErrRefreshTokenExpired
+	}
+
+	if !bound {
+		return AuthTokens{}, rejectFingerprintMismatch(ctx, oldToken)
+	}
+
+	user, err := Users.FindByID(ctx, oldToken.UserID)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	if !user.IsActive {
+		return AuthTokens{}, ErrUserInactive
+	}
+
+	// One transaction, so a failure can't leave the old token revoked without a
+	// replacement.
+	var tokens AuthTokens
+	err = Transaction(ctx, func(tx Stores) error {
+		// Revoke first so the rotated token doesn't count against the session limit.
+		// The revoke only succeeds for one of concurrent refreshes of the token;
+		// the others were presenting a token that is no longer active.
+		revoked, err := tx.Tokens.Revoke(ctx, oldToken.ID, now)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return ErrTokenReuse
+		}
+
+		tokens, err = issueAuthTokens(ctx, tx.Tokens, user, oldToken.Client, oldToken.Device, fingerprint)
+		if err != nil {
+			return err
+		}
+
+		return tx.Tokens.Update(ctx, &oldToken, map[string]any{"replaced_by": utils.HashRefreshToken(tokens.RefreshToken)})
+	})
+	if errors.Is(err, ErrTokenReuse) {
+		return AuthTokens{}, revokeReusedToken(ctx, oldToken)
+	}
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	return tokens, nil
+}
+
+// revokeReusedToken revokes every session of the user, including the
+// replacement handed out for token, and returns ErrTokenReuse.
+func revokeReusedToken(ctx context.Context, token models.RefreshToken) error {
+	revoked, err := RevokeAllUserTokens(ctx, token.UserID)
+	if err != nil {
+		return err
+	}
+	auditTokenReuse(ctx, token, revoked)
+	return ErrTokenReuse
+}
+
+// replayRotation answers a retried refresh within REFRESH_ROTATION_GRACE (10s
+// by default) of the rotation. Only hashes are stored, so the token handed out
+// by the rotation can't be sent again: instead it is revoked and the client gets
+// a new token pair in its place. That works once per rotation; a second replay
+// finds the replacement revoked and is treated as token reuse.
+func replayRotation(ctx context.Context, oldToken models.RefreshToken, fingerprint utils.ClientFingerprint) (AuthTokens, bool, error) {
+	now := time.Now()
+	if oldToken.ReplacedBy == "" || now.Sub(*oldToken.RevokedAt) > sessionConfig.RotationGrace {
+		return AuthTokens{}, false, nil
+	}
+
+	replacement, err := Tokens.FindByHash(ctx, oldToken.ReplacedBy)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return AuthTokens{}, false, nil
+		}
+		return AuthTokens{}, false, err
 	}
+	if replacement.RevokedAt != nil || !replacement.ExpiryDate.After(now) {
+		return AuthTokens{}, false, nil
+	}
+
+	user, err := Users.FindByID(ctx, oldToken.UserID)
+	if err != nil {
+		return AuthTokens{}, false, err
+	}
+	if !user.IsActive {
+		return AuthTokens{}, false, ErrUserInactive
+	}
+
+	var tokens AuthTokens
+	err = Transaction(ctx, func(tx Stores) error {
+		// Conditional, so concurrent replays can't both take the replacement's place.
+		revoked, err := tx.Tokens.Revoke(ctx, replacement.ID, now)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return ErrTokenReuse
+		}
+
+		tokens, err = issueAuthTokens(ctx, tx.Tokens, user, oldToken.Client, oldToken.Device, fingerprint)
+		return err
+	})
+	if errors.Is(err, ErrTokenReuse) {
+		return AuthTokens{}, false, nil
+	}
+	if err != nil {
+		return AuthTokens{}, false, err
+	}
+	return tokens, true, nil
+}
 
-	if err := config.DB.Create(&refreshTokenModel).Error; err != nil {
-		return "", "", err
+// rejectFingerprintMismatch refuses a token presented by another client. The
+// token itself stays usable from the original client unless
+// REFRESH_TOKEN_BINDING_REVOKE is set, in which case every session of the user
+// is revoked as for token reuse.
+func rejectFingerprintMismatch(ctx context.Context, token models.RefreshToken) error {
+	var revoked int64
+	if sessionConfig.RevokeOnBindingMismatch {
+		var err error
+		if revoked, err = RevokeAllUserTokens(ctx, token.UserID); err != nil {
+			return err
+		}
 	}
+	auditRefreshToken(ctx, AuditRefreshTokenMismatch, token, revoked)
+	return ErrFingerprintMismatch
+}
+
+func auditTokenReuse(ctx context.Context, token models.RefreshToken, revoked int64) {
+	auditRefreshToken(ctx, AuditRefreshTokenReuse, token, revoked)
+}
 
-	return accessToken, refreshToken, nil
+func auditRefreshToken(ctx context.Context, action string, token models.RefreshToken, revoked int64) {
+	event := AuditEvent{
+		Action:   action,
+		ActorID:  token.UserID,
+		Target:   fmt.Sprintf("refresh_token:%d", token.ID),
+		Metadata: map[string]any{"device": token.Device, "revoked_sessions": revoked},
+	}
+	if user, err := Users.FindByID(ctx, token.UserID); err == nil {
+		event.TenantID = user.TenantID
+	}
+	Audit(ctx, event)
 }
 
-func RefreshAndRevokeToken(oldRefreshToken string) (accessToken string, newRefreshToken string, err error) {
-	var oldToken models.RefreshToken
-	if err := config.DB.Where("token = ? AND expiry_date > ?", oldRefreshToken, time.Now()).First(&oldToken).Error; err != nil {
-		return "", "", err
+func generateAccessToken(user models.User, client string) (string, error) {
+	audience, err := utils.ClientAudience(client)
+	if err != nil {
+		return "", err
 	}
+	return utils.GenerateAccessTokenForAudience(user.ID, user.Role, audience, map[string]any{
+		"tenant_id":      user.TenantID,
+		"email_verified": user.EmailVerified,
+		"is_admin":       user.Role == "admin",
+	})
+}
 
-	var user models.User
-	if err := config.DB.First(&user, oldToken.UserID).Error; err != nil {
-		return "", "", err
+// idleExpired reports whether the token sat unused for longer than
+// REFRESH_IDLE_TIMEOUT. The policy is off when the variable is unset or 0.
+func idleExpired(token models.RefreshToken, now time.Time) bool {
+	idleTimeout := sessionConfig.IdleTimeout
+	if idleTimeout == 0 {
+		return false
 	}
 
-	config.DB.Delete(&oldToken)
+	lastUsed := token.LastUsedAt
+	if lastUsed.IsZero() {
+		lastUsed = token.CreatedAt
+	}
+	return now.Sub(lastUsed) > idleTimeout
+}
 
-	accessToken, newRefreshToken, err = GenerateAuthToken(user)
+func enforceSessionLimit(ctx context.Context, tokens stores.TokenStore, userID uint) (int64, error) {
+	active, err := tokens.ListActive(ctx, userID, time.Now())
 	if err != nil {
-		return "", "", err
+		return 0, err
+	}
+
+	count := int64(len(active))
+	maxSessions := int64(sessionConfig.MaxPerUser)
+	if maxSessions == 0 || count <= maxSessions {
+		return count, nil
+	}
+
+	var oldestIDs []uint
+	for _, token := range active[maxSessions:] {
+		oldestIDs = append(oldestIDs, token.ID)
+	}
+	if err := tokens.DeleteByIDs(ctx, oldestIDs); err != nil {
+		return 0, err
 	}
 
-	return accessToken, newRefreshToken, nil
+	return maxSessions, nil
+}
+
+// ListActiveSessions returns the user's unrevoked, unexpired refresh tokens,
+// newest first.
+func ListActiveSessions(ctx context.Context, userID uint) ([]models.RefreshToken, error) {
+	return Tokens.ListActive(ctx, userID, time.Now())
+}
+
+// RevokeSession deletes one of the user's active sessions, returning
+// gorm.ErrRecordNotFound if it doesn't exist or belongs to someone else.
+func RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	deleted, err := Tokens.DeleteUnrevoked(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ForceRevokeRefreshToken deletes the refresh token with the given id whoever
+// owns it, as long as the owner is in tenantID; otherwise it returns
+// gorm.ErrRecordNotFound. Access tokens already issued from it stay valid until
+// they expire. With REFRESH_TOKEN_MODE=jwt there are no rows to delete.
+func ForceRevokeRefreshToken(ctx context.Context, id, tenantID uint) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := Transaction(ctx, func(tx Stores) error {
+		var err error
+		token, err = tx.Tokens.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		owner, err := tx.Users.FindByID(ctx, token.UserID)
+		if err != nil {
+			return err
+		}
+		if owner.TenantID != tenantID {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Tokens.DeleteByIDs(ctx, []uint{token.ID})
+	})
+	return token, err
+}
+
+// FindRefreshToken looks up the token a client presented by its hash.
+func FindRefreshToken(ctx context.Context, token string) (models.RefreshToken, error) {
+	return Tokens.FindByHash(ctx, utils.HashRefreshToken(token))
+}
+
+func RevokeRefreshToken(ctx context.Context, token string) error {
+	if refreshTokenMode == RefreshTokenJWT {
+		return revokeRefreshJWT(ctx, token)
+	}
+	return Tokens.DeleteByHash(ctx, utils.HashRefreshToken(token))
+}
+
+// RefreshTokenSession names the user and session behind a presented refresh
+// token, for auditing.
+func RefreshTokenSession(ctx context.Context, token string) (userID uint, target string, err error) {
+	if refreshTokenMode == RefreshTokenJWT {
+		claims, err := utils.ValidateRefreshJWT(token)
+		if err != nil {
+			return 0, "", err
+		}
+		return claims.UserID, "refresh_token:" + claims.ID, nil
+	}
+
+	session, err := FindRefreshToken(ctx, token)
+	if err != nil {
+		return 0, "", err
+	}
+	return session.UserID, fmt.Sprintf("session:%d", session.ID), nil
+}
+
+// RevokeAllUserTokens deletes the user's active refresh tokens. Rotated tokens
+// are kept so a later replay is still recognised as reuse.
+func RevokeAllUserTokens(ctx context.Context, userID uint) (int64, error) {
+	return Tokens.DeleteAllUnrevoked(ctx, userID)
+}
+
+func PurgeExpiredRefreshTokens(ctx context.Context) (int64, error) {
+	return Tokens.DeleteExpired(ctx, time.Now())
+}
+
+// StartRefreshTokenCleanup purges expired refresh tokens every interval until
+// ctx is cancelled.
+func StartRefreshTokenCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PurgeExpiredRefreshTokens(ctx); err != nil {
+				log.Println("failed to purge expired refresh tokens:", err)
+			}
+		}
+	}
 }
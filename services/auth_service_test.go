@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"jwt-poc/internal/testdb"
+	"jwt-poc/models"
+	"jwt-poc/services"
+	"jwt-poc/stores"
+	"jwt-poc/utils"
+	"testing"
+)
+
+var errStoreFailed = errors.New("store failed")
+
+// failingTokenStore fails one step of a rotation and passes everything else
+// through: "Create" the new token, "Update" linking the old one to it.
+type failingTokenStore struct {
+	stores.TokenStore
+	failOn string
+}
+
+func (s failingTokenStore) Create(ctx context.Context, token *models.RefreshToken) error {
+	if s.failOn == "Create" {
+		return errStoreFailed
+	}
+	return s.TokenStore.Create(ctx, token)
+}
+
+func (s failingTokenStore) Update(ctx context.Context, token *models.RefreshToken, fields map[string]any) error {
+	if _, linking := fields["replaced_by"]; linking && s.failOn == "Update" {
+		return errStoreFailed
+	}
+	return s.TokenStore.Update(ctx, token, fields)
+}
+
+func TestRefreshAndRevokeTokenRollsBack(t *testing.T) {
+	for _, failOn := range []string{"Create", "Update"} {
+		t.Run(failOn, func(t *testing.T) {
+			db := testdb.Open(t)
+			ctx := context.Background()
+			user := testdb.CreateUser(t, "alice")
+			fingerprint := utils.NewClientFingerprint("test-agent", "192.0.2.1")
+			issued, err := services.GenerateAuthToken(ctx, user, "", "", fingerprint)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			transaction := services.Transaction
+			t.Cleanup(func() { services.Transaction = transaction })
+			services.Transaction = func(ctx context.Context, fn func(tx services.Stores) error) error {
+				return transaction(ctx, func(tx services.Stores) error {
+					tx.Tokens = failingTokenStore{TokenStore: tx.Tokens, failOn: failOn}
+					return fn(tx)
+				})
+			}
+
+			if _, err := services.RefreshAndRevokeToken(ctx, issued.RefreshToken, fingerprint); !errors.Is(err, errStoreFailed) {
+				t.Fatalf("RefreshAndRevokeToken() error = %v, want %v", err, errStoreFailed)
+			}
+
+			oldToken, err := services.FindRefreshToken(ctx, issued.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oldToken.RevokedAt != nil || oldToken.ReplacedBy != "" {
+				t.Errorf("old token revoked_at = %v, replaced_by = %q, want it left active", oldToken.RevokedAt, oldToken.ReplacedBy)
+			}
+			var count int64
+			if err := db.Model(&models.RefreshToken{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 {
+				t.Errorf("refresh tokens = %d, want 1", count)
+			}
+
+			services.Transaction = transaction
+			if _, err := services.RefreshAndRevokeToken(ctx, issued.RefreshToken, fingerprint); err != nil {
+				t.Errorf("refresh after rollback: %v", err)
+			}
+		})
+	}
+}
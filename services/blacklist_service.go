@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"log"
+	"time"
+)
+
+// BlacklistToken rejects the access token with the given jti until exp, after
+// which the token would be invalid anyway and the row can be purged.
+func BlacklistToken(ctx context.Context, jti string, exp time.Time) error {
+	entry := models.TokenBlacklist{
+		JTI:       jti,
+		ExpiresAt: exp,
+	}
+	return config.DB.WithContext(ctx).Save(&entry).Error
+}
+
+func IsTokenBlacklisted(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	if err := config.DB.WithContext(ctx).Model(&models.TokenBlacklist{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func PurgeExpiredBlacklist(ctx context.Context) (int64, error) {
+	result := config.DB.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.TokenBlacklist{})
+	return result.RowsAffected, result.Error
+}
+
+func StartBlacklistCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PurgeExpiredBlacklist(ctx); err != nil {
+				log.Println("failed to purge token blacklist:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key was already used with a different request")
+)
+
+// BeginIdempotentRequest claims key within scope for a request whose body
+// hashes to requestHash. It returns the stored record and true when the key
+// has already been answered, so the caller can replay the response. The unique
+// index on (scope, key) makes concurrent retries race for the claim rather
+// than both running.
+func BeginIdempotentRequest(ctx context.Context, scope, key, requestHash string, ttl time.Duration) (models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	if err := config.DB.WithContext(ctx).Where("scope = ? AND key = ? AND expires_at <= ?", scope, key, now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return models.IdempotencyKey{}, false, err
+	}
+
+	record := models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(ttl),
+	}
+	err := config.DB.WithContext(ctx).Create(&record).Error
+	if err == nil {
+		return record, false, nil
+	}
+	if !isUniqueViolation(err) {
+		return models.IdempotencyKey{}, false, err
+	}
+
+	var existing models.IdempotencyKey
+	if err := config.DB.WithContext(ctx).Where("scope = ? AND key = ?", scope, key).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Released between our insert and this read; let the client retry.
+			return models.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+		}
+		return models.IdempotencyKey{}, false, err
+	}
+	switch {
+	case existing.RequestHash != requestHash:
+		return models.IdempotencyKey{}, false, ErrIdempotencyKeyMismatch
+	case existing.StatusCode == 0:
+		return models.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+	}
+	return existing, true, nil
+}
+
+// CompleteIdempotentRequest stores the response for later replays.
+func CompleteIdempotentRequest(ctx context.Context, record *models.IdempotencyKey, statusCode int, contentType string, body []byte) error {
+	return config.DB.WithContext(ctx).Model(record).Updates(map[string]any{
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"body":         body,
+	}).Error
+}
+
+// ReleaseIdempotencyKey drops a claim whose request failed without a
+// response worth replaying, so a retry runs again.
+func ReleaseIdempotencyKey(ctx context.Context, record *models.IdempotencyKey) error {
+	return config.DB.WithContext(ctx).Delete(record).Error
+}
+
+func PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result := config.DB.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+func StartIdempotencyKeyCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PurgeExpiredIdempotencyKeys(ctx); err != nil {
+				log.Println("failed to purge idempotency keys:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"time"
+)
+
+var (
+	ErrImpersonateSelf  = errors.New("cannot impersonate yourself")
+	ErrImpersonateAdmin = errors.New("admins cannot be impersonated")
+)
+
+// Impersonate issues actorID an access token acting as user. There is no
+// refresh token: once it expires the admin has to impersonate again, which is
+// audited again. Admins can't be impersonated, so an impersonation token never
+// carries the admin role.
+func Impersonate(user models.User, actorID uint) (string, time.Time, error) {
+	switch {
+	case user.ID == actorID:
+		return "", time.Time{}, ErrImpersonateSelf
+	case user.Role == "admin":
+		return "", time.Time{}, ErrImpersonateAdmin
+	case !user.IsActive:
+		return "", time.Time{}, ErrUserInactive
+	}
+
+	return utils.GenerateImpersonationToken(user.ID, user.Role, actorID, map[string]any{
+		"tenant_id":      user.TenantID,
+		"email_verified": user.EmailVerified,
+		"is_admin":       false,
+	})
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"log"
+	"time"
+)
+
+var lockoutConfig = config.LockoutConfig{Threshold: 5, Duration: 15 * time.Minute}
+
+// SetLockoutConfig applies LOCKOUT_THRESHOLD and LOCKOUT_DURATION once at
+// startup; config.Load has already checked them.
+func SetLockoutConfig(cfg config.LockoutConfig) {
+	lockoutConfig = cfg
+}
+
+func IsAccountLocked(user models.User) bool {
+	return user.LockedUntil != nil && user.LockedUntil.After(time.Now())
+}
+
+// RecordFailedLogin increments the user's failed attempts and locks the account
+// for LOCKOUT_DURATION once LOCKOUT_THRESHOLD consecutive failures are reached.
+func RecordFailedLogin(ctx context.Context, user *models.User) error {
+	if user.FailedAttempts+1 < lockoutConfig.Threshold {
+		user.FailedAttempts++
+		return Users.IncrementFailedAttempts(ctx, user)
+	}
+
+	lockedUntil := time.Now().Add(lockoutConfig.Duration)
+	user.FailedAttempts = 0
+	user.LockedUntil = &lockedUntil
+	if err := Users.Update(ctx, user, map[string]any{
+		"failed_attempts": 0,
+		"locked_until":    lockedUntil,
+	}); err != nil {
+		return err
+	}
+
+	// Sent in the background so a slow mail server doesn't delay the response.
+	go sendLockoutNotice(user.Email, lockedUntil)
+	return nil
+}
+
+func sendLockoutNotice(email string, lockedUntil time.Time) {
+	body := fmt.Sprintf("Your account was locked after repeated failed login attempts.\n\n"+
+		"It unlocks at %s. If this wasn't you, consider changing your password.",
+		lockedUntil.UTC().Format(time.RFC1123))
+	if err := Mail.Send(email, "Your account has been locked", body); err != nil {
+		log.Println("failed to send lockout notice:", err)
+	}
+}
+
+func ResetFailedLogins(ctx context.Context, user *models.User) error {
+	if user.FailedAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	user.FailedAttempts = 0
+	user.LockedUntil = nil
+	return Users.Update(ctx, user, map[string]any{
+		"failed_attempts": 0,
+		"locked_until":    nil,
+	})
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"jwt-poc/config"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain-text email. Mail is set at startup by LoadMailer.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+var Mail Mailer = LogMailer{}
+
+// LoadMailer sets Mail from the MAILER settings: log (the default) prints
+// messages to stdout, smtp sends them through SMTP_HOST:SMTP_PORT from
+// SMTP_FROM, authenticating with SMTP_USERNAME and SMTP_PASSWORD when set.
+// config.Load has already checked them.
+func LoadMailer(cfg config.MailerConfig) {
+	if cfg.Kind != "smtp" {
+		Mail = LogMailer{}
+		return
+	}
+	Mail = SMTPMailer{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}
+}
+
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	fmt.Printf("mail to %s: %s\n%s\n", to, subject, body)
+	return nil
+}
+
+// SMTPMailer uses net/smtp, which upgrades to TLS with STARTTLS when the
+// server offers it and refuses PLAIN auth over an unencrypted connection.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	// Recipients and subjects end up in headers, so a line break would let them
+	// inject extra ones.
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return errors.New("mail recipient and subject must not contain line breaks")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	headers := []string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	return smtp.SendMail(addr, auth, m.From, []string{to}, []byte(message))
+}
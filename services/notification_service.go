@@ -0,0 +1,79 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// notificationWriteTimeout keeps a stalled client from blocking Notify.
+const notificationWriteTimeout = 5 * time.Second
+
+// socket serialises writes: a websocket.Conn allows one writer at a time and
+// Notify may run from several requests at once.
+type socket struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (s *socket) writeJSON(msg any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.conn.SetWriteDeadline(time.Now().Add(notificationWriteTimeout)); err != nil {
+		return err
+	}
+	return s.conn.WriteJSON(msg)
+}
+
+var (
+	socketsMu sync.RWMutex
+	sockets   = map[uint]map[*socket]struct{}{}
+)
+
+// RegisterSocket adds conn to userID's open sockets and returns the function
+// that removes it, to be called when the connection closes. Sockets are kept
+// in memory, so Notify only reaches users connected to this instance.
+func RegisterSocket(userID uint, conn *websocket.Conn) func() {
+	s := &socket{conn: conn}
+
+	socketsMu.Lock()
+	if sockets[userID] == nil {
+		sockets[userID] = map[*socket]struct{}{}
+	}
+	sockets[userID][s] = struct{}{}
+	socketsMu.Unlock()
+
+	return func() {
+		socketsMu.Lock()
+		defer socketsMu.Unlock()
+		delete(sockets[userID], s)
+		if len(sockets[userID]) == 0 {
+			delete(sockets, userID)
+		}
+	}
+}
+
+// Notify sends msg as JSON to every open socket of userID and returns how many
+// received it. A socket that fails the write is closed, which ends its read
+// loop and unregisters it.
+func Notify(userID uint, msg any) int {
+	socketsMu.RLock()
+	targets := make([]*socket, 0, len(sockets[userID]))
+	for s := range sockets[userID] {
+		targets = append(targets, s)
+	}
+	socketsMu.RUnlock()
+
+	delivered := 0
+	for _, s := range targets {
+		if err := s.writeJSON(msg); err != nil {
+			log.Printf("failed to notify user %d: %v", userID, err)
+			s.conn.Close()
+			continue
+		}
+		delivered++
+	}
+	return delivered
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"slices"
+
+	"gorm.io/gorm/clause"
+)
+
+// HasPermission resolves permission for a user with role: the role's
+// permissions are checked first, and the user's grants are only loaded when
+// the role doesn't cover it.
+func HasPermission(ctx context.Context, userID uint, role, permission string) (bool, error) {
+	if utils.PermissionGranted(utils.RolePermissions(role), permission) {
+		return true, nil
+	}
+
+	grants, err := ListUserPermissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return utils.PermissionGranted(grants, permission), nil
+}
+
+// EffectivePermissions is the sorted union of role's permissions and grants,
+// the user's direct grants from ListUserPermissions.
+func EffectivePermissions(role string, grants []string) []string {
+	permissions := append(append([]string{}, utils.RolePermissions(role)...), grants...)
+	slices.Sort(permissions)
+	return slices.Compact(permissions)
+}
+
+// ListUserPermissions returns the permissions granted to the user directly.
+func ListUserPermissions(ctx context.Context, userID uint) ([]string, error) {
+	permissions := []string{}
+	err := config.DB.WithContext(ctx).Model(&models.UserPermission{}).
+		Where("user_id = ?", userID).Order("permission").
+		Pluck("permission", &permissions).Error
+	return permissions, err
+}
+
+// GrantPermission is idempotent: granting a permission twice keeps one row.
+func GrantPermission(ctx context.Context, userID uint, permission string) error {
+	return config.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserPermission{UserID: userID, Permission: permission}).Error
+}
+
+// RevokePermission reports whether the user had the grant. Permissions of the
+// user's role can't be revoked here.
+func RevokePermission(ctx context.Context, userID uint, permission string) (bool, error) {
+	result := config.DB.WithContext(ctx).Where("user_id = ? AND permission = ?", userID, permission).Delete(&models.UserPermission{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Refresh token modes selected with REFRESH_TOKEN_MODE.
+const (
+	RefreshTokenOpaque = "opaque"
+	RefreshTokenJWT    = "jwt"
+)
+
+var ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+
+var refreshTokenMode = RefreshTokenOpaque
+
+// SetRefreshTokenMode applies REFRESH_TOKEN_MODE once at startup; config.Load
+// has already checked it.
+//
+// opaque, the default, stores every refresh token, so sessions can be listed
+// and logout-all, password and role changes and user deletion revoke them at
+// once.
+//
+// jwt issues signed refresh JWTs and keeps no session rows. A refresh verifies
+// the signature, loads the user and records the old jti in the token blacklist,
+// which doubles as the revocation list. The tradeoff is that only a token whose
+// jti is known can be revoked: logout and rotation work, but logout-all and
+// password or role changes leave the user's other refresh JWTs valid until
+// they expire (deleted users are still refused). Sessions aren't listed,
+// MAX_SESSIONS_PER_USER doesn't apply, and a replayed rotated token is refused
+// without revoking the rest of the chain or honouring REFRESH_ROTATION_GRACE.
+func SetRefreshTokenMode(mode string) {
+	refreshTokenMode = mode
+}
+
+func RefreshTokenMode() string {
+	return refreshTokenMode
+}
+
+func issueRefreshJWT(user models.User, client string, fingerprint utils.ClientFingerprint) (AuthTokens, error) {
+	now := time.Now()
+	accessToken, err := generateAccessToken(user, client)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	refreshToken, claims, err := utils.GenerateRefreshJWT(user.ID, client, fingerprint, RefreshTokenTTL)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	return AuthTokens{
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		AccessTokenExpiresAt:  now.Add(utils.AccessTokenTTL),
+		RefreshTokenExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func refreshWithJWT(ctx context.Context, refreshToken string, fingerprint utils.ClientFingerprint) (AuthTokens, error) {
+	claims, err := utils.ValidateRefreshJWT(refreshToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return AuthTokens{}, ErrRefreshTokenExpired
+		}
+		return AuthTokens{}, err
+	}
+
+	if !fingerprint.Matches(claims.Fingerprint()) {
+		Audit(ctx, AuditEvent{
+			Action:  AuditRefreshTokenMismatch,
+			ActorID: claims.UserID,
+			Target:  "refresh_token:" + claims.ID,
+		})
+		return AuthTokens{}, ErrFingerprintMismatch
+	}
+
+	user, err := Users.FindByID(ctx, claims.UserID)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	if !user.IsActive {
+		return AuthTokens{}, ErrUserInactive
+	}
+
+	// Inserting the jti is the check: of two concurrent refreshes with the same
+	// token only one gets past the primary key.
+	entry := models.TokenBlacklist{JTI: claims.ID, ExpiresAt: claims.ExpiresAt.Time}
+	if err := config.DB.WithContext(ctx).Create(&entry).Error; err != nil {
+		if isUniqueViolation(err) {
+			return AuthTokens{}, ErrRefreshTokenRevoked
+		}
+		return AuthTokens{}, err
+	}
+
+	return issueRefreshJWT(user, claims.Client, fingerprint)
+}
+
+// revokeRefreshJWT blacklists the token's jti until it expires. Tokens that
+// don't validate can't be used anyway and are ignored.
+func revokeRefreshJWT(ctx context.Context, refreshToken string) error {
+	claims, err := utils.ValidateRefreshJWT(refreshToken)
+	if err != nil {
+		return nil
+	}
+	return BlacklistToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"jwt-poc/stores"
+
+	"gorm.io/gorm"
+)
+
+// Users and Tokens back the auth and user flows. main wires them to config.DB
+// through UseGormStores; tests can assign their own implementations.
+var (
+	Users  stores.UserStore
+	Tokens stores.TokenStore
+)
+
+// Stores is what a Transaction callback works with. DB is the transaction
+// itself, for tables that have no store.
+type Stores struct {
+	Users  stores.UserStore
+	Tokens stores.TokenStore
+	DB     *gorm.DB
+}
+
+// Transaction runs fn with stores bound to one database transaction, which is
+// rolled back if fn returns an error. UseGormStores sets it.
+var Transaction func(ctx context.Context, fn func(tx Stores) error) error
+
+func UseGormStores(db *gorm.DB) {
+	Users = stores.NewGormUserStore(db)
+	Tokens = stores.NewGormTokenStore(db)
+	Transaction = func(ctx context.Context, fn func(tx Stores) error) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(Stores{
+				Users:  stores.NewGormUserStore(tx),
+				Tokens: stores.NewGormTokenStore(tx),
+				DB:     tx,
+			})
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const twoFactorChallengeTTL = 5 * time.Minute
+
+var (
+	ErrTOTPAlreadyEnabled        = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled           = errors.New("two-factor enrollment has not been started")
+	ErrInvalidTOTPCode           = errors.New("invalid two-factor code")
+	ErrInvalidTwoFactorChallenge = errors.New("invalid or expired two-factor challenge")
+)
+
+var totpIssuer = "jwt-poc"
+
+// SetTOTPIssuer applies TOTP_ISSUER, the name authenticator apps show for the
+// account, once at startup.
+func SetTOTPIssuer(issuer string) {
+	totpIssuer = issuer
+}
+
+// TOTPEnrollment is what an authenticator app needs to add the account. QRCode
+// is a PNG data URI of URL.
+type TOTPEnrollment struct {
+	Secret string
+	URL    string
+	QRCode string
+}
+
+// EnrollTOTP generates a fresh secret for the user. 2FA stays disabled until
+// ConfirmTOTP sees a valid code, so an abandoned enrollment can't lock anyone out.
+func EnrollTOTP(ctx context.Context, user models.User) (TOTPEnrollment, error) {
+	if user.TOTPEnabled {
+		return TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+	})
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	if err := config.DB.WithContext(ctx).Model(&user).Update("totp_secret", key.Secret()).Error; err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+func ConfirmTOTP(ctx context.Context, user models.User, code string) error {
+	if user.TOTPEnabled {
+		return ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return ErrTOTPNotEnrolled
+	}
+	if !validateTOTPCode(user.TOTPSecret, code) {
+		return ErrInvalidTOTPCode
+	}
+
+	return config.DB.WithContext(ctx).Model(&user).Update("totp_enabled", true).Error
+}
+
+// CreateTwoFactorChallenge is issued instead of tokens after a correct password
+// for a user with 2FA enabled. The client the login named is kept for the
+// tokens issued once the challenge is completed.
+func CreateTwoFactorChallenge(ctx context.Context, user models.User, client string) (string, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.TwoFactorChallenge{
+		UserID:    user.ID,
+		Client:    client,
+		Token:     token,
+		ExpiresAt: time.Now().Add(twoFactorChallengeTTL),
+	}
+	if err := config.DB.WithContext(ctx).Create(&challenge).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// CompleteTwoFactorChallenge checks code against the challenge's user and
+// returns that user and the client of the login. Challenges are single-use
+// even when the code is wrong, so guessing codes means going back through the
+// rate-limited password login. Of concurrent submissions of one challenge only
+// the one whose delete removed it goes on.
+func CompleteTwoFactorChallenge(ctx context.Context, token, code string) (models.User, string, error) {
+	var challenge models.TwoFactorChallenge
+	if err := config.DB.WithContext(ctx).Where("token = ? AND expires_at > ?", token, time.Now()).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, "", ErrInvalidTwoFactorChallenge
+		}
+		return models.User{}, "", err
+	}
+
+	result := config.DB.WithContext(ctx).Where("id = ?", challenge.ID).Delete(&models.TwoFactorChallenge{})
+	if result.Error != nil {
+		return models.User{}, "", result.Error
+	}
+	if result.RowsAffected != 1 {
+		return models.User{}, "", ErrInvalidTwoFactorChallenge
+	}
+
+	user, err := FindUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return models.User{}, "", err
+	}
+
+	// The user is returned with ErrInvalidTOTPCode so the failure can be
+	// attributed to them.
+	if !user.TOTPEnabled || !validateTOTPCode(user.TOTPSecret, code) {
+		return user, "", ErrInvalidTOTPCode
+	}
+
+	return user, challenge.Client, nil
+}
+
+// validateTOTPCode accepts the current 30 second step and one on either side to
+// allow for clock drift.
+func validateTOTPCode(secret, code string) bool {
+	valid, err := totp.ValidateCustom(code, secret, time.Now(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	return err == nil && valid
+}
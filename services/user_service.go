@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUsernameExists = errors.New("username already exists")
+	ErrEmailExists    = errors.New("email already registered")
+	ErrUserInactive   = errors.New("user account is deactivated")
+)
+
+// CreateUser inserts the user and relies on the unique indexes to catch
+// duplicates, so concurrent registrations can't both get through.
+func CreateUser(ctx context.Context, user *models.User) error {
+	return createUserError(Users.Create(ctx, user))
+}
+
+// createUserError maps unique violations to ErrUsernameExists or ErrEmailExists.
+func createUserError(err error) error {
+	if err == nil || !isUniqueViolation(err) {
+		return err
+	}
+
+	// Match the column in the SQLite ("users.tenant_id, users.email") or
+	// Postgres ("idx_users_tenant_email") error message.
+	if strings.Contains(err.Error(), "email") {
+		return ErrEmailExists
+	}
+	return ErrUsernameExists
+}
+
+// BulkInsertError reports which row of a BulkCreateUsers batch failed.
+type BulkInsertError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkInsertError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+func (e *BulkInsertError) Unwrap() error {
+	return e.Err
+}
+
+// BulkCreateUsers inserts the users in one transaction, so either all of them
+// are created or none is.
+func BulkCreateUsers(ctx context.Context, users []models.User) error {
+	return Transaction(ctx, func(tx Stores) error {
+		for i := range users {
+			if err := createUserError(tx.Users.Create(ctx, &users[i])); err != nil {
+				return &BulkInsertError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// TakenUsernamesAndEmails returns which of the given usernames and emails
+// already belong to a user of the tenant. Soft-deleted users count, as they still hold the
+// unique index entries.
+func TakenUsernamesAndEmails(ctx context.Context, tenantID uint, usernames, emails []string) (map[string]bool, map[string]bool, error) {
+	var existing []models.User
+	err := config.DB.WithContext(ctx).Unscoped().Select("username", "email").
+		Where("tenant_id = ? AND (username IN ? OR email IN ?)", tenantID, usernames, emails).
+		Find(&existing).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	takenUsernames := map[string]bool{}
+	takenEmails := map[string]bool{}
+	for _, user := range existing {
+		takenUsernames[user.Username] = true
+		takenEmails[user.Email] = true
+	}
+	return takenUsernames, takenEmails, nil
+}
+
+func isUniqueViolation(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") || strings.Contains(msg, "duplicate key value")
+}
+
+// FindUserByID returns gorm.ErrRecordNotFound for missing or soft-deleted users.
+func FindUserByID(ctx context.Context, id uint) (models.User, error) {
+	return Users.FindByID(ctx, id)
+}
+
+var registrationTenantID uint
+
+// SetRegistrationTenant applies REGISTRATION_TENANT_ID once at startup: the
+// tenant of users signing up through the public registration.
+func SetRegistrationTenant(id uint) {
+	registrationTenantID = id
+}
+
+func RegistrationTenant() uint {
+	return registrationTenantID
+}
+
+var userDeleteMode = "soft"
+
+// SetUserDeleteMode applies USER_DELETE_MODE once at startup; config.Load has
+// already checked it.
+//
+// soft, the default, keeps the user row, and with it the username and email,
+// and revokes the user's refresh tokens and API keys. hard removes the row and
+// lets the ON DELETE CASCADE foreign keys remove their tokens, API keys,
+// verification tokens, 2FA challenges and permission grants. Audit entries
+// keep the user's id either way.
+func SetUserDeleteMode(mode string) {
+	userDeleteMode = mode
+}
+
+// DeleteUser deletes the user as set by SetUserDeleteMode.
+func DeleteUser(ctx context.Context, id uint) error {
+	if userDeleteMode == "hard" {
+		deleted, err := Users.Purge(ctx, id)
+		if err == nil && deleted == 0 {
+			err = gorm.ErrRecordNotFound
+		}
+		return err
+	}
+
+	return Transaction(ctx, func(tx Stores) error {
+		deleted, err := tx.Users.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if _, err := tx.Tokens.DeleteAllUnrevoked(ctx, id); err != nil {
+			return err
+		}
+
+		return tx.DB.Model(&models.ApiKey{}).Where("user_id = ?", id).Update("is_active", false).Error
+	})
+}
+
+// ChangeUserRole updates the role and revokes the user's refresh tokens, so the
+// next login picks up the new role. It returns how many sessions were revoked.
+func ChangeUserRole(ctx context.Context, user *models.User, role string) (int64, error) {
+	return updateAndRevokeSessions(ctx, user, map[string]any{"role": role})
+}
+
+// ChangePassword stores the new hash and revokes every session, as they were
+// all authenticated with the old password.
+func ChangePassword(ctx context.Context, user *models.User, passwordHash string) (int64, error) {
+	return updateAndRevokeSessions(ctx, user, map[string]any{"password_hash": passwordHash})
+}
+
+// DeactivateUser suspends the account and revokes its refresh tokens. Access
+// tokens already issued are only refused on routes using WithFreshUserCheck.
+func DeactivateUser(ctx context.Context, user *models.User) (int64, error) {
+	return updateAndRevokeSessions(ctx, user, map[string]any{"is_active": false})
+}
+
+func ReactivateUser(ctx context.Context, user *models.User) error {
+	return Users.Update(ctx, user, map[string]any{"is_active": true})
+}
+
+func updateAndRevokeSessions(ctx context.Context, user *models.User, fields map[string]any) (int64, error) {
+	var revoked int64
+	err := Transaction(ctx, func(tx Stores) error {
+		if err := tx.Users.Update(ctx, user, fields); err != nil {
+			return err
+		}
+
+		var err error
+		revoked, err = tx.Tokens.DeleteAllUnrevoked(ctx, user.ID)
+		return err
+	})
+	return revoked, err
+}
+
+// RehashPasswordIfNeeded upgrades the stored hash to the current algorithm and
+// cost. Call it only after password has been verified against the stored hash.
+// Failures are logged and leave the old, still valid hash in place.
+func RehashPasswordIfNeeded(ctx context.Context, user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Println("failed to rehash password:", err)
+		return
+	}
+	if err := Users.Update(ctx, user, map[string]any{"password_hash": hash}); err != nil {
+		log.Println("failed to store rehashed password:", err)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jwt-poc/config"
+	"jwt-poc/models"
+	"jwt-poc/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const verificationTokenTTL = 24 * time.Hour
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// Email change modes selected with EMAIL_CHANGE_MODE.
+const (
+	EmailChangePending = "pending"
+	EmailChangeBlock   = "block"
+)
+
+var ErrEmailUnchanged = errors.New("new email is the same as the current one")
+
+var verificationConfig = config.VerificationConfig{EmailChangeMode: EmailChangePending}
+
+// SetVerificationConfig applies REQUIRE_EMAIL_VERIFICATION, APP_BASE_URL and
+// EMAIL_CHANGE_MODE once at startup; config.Load has already checked them.
+func SetVerificationConfig(cfg config.VerificationConfig) {
+	verificationConfig = cfg
+}
+
+// SendVerificationEmail issues a new verification token for the user and mails
+// them the link.
+func SendVerificationEmail(ctx context.Context, user models.User) error {
+	return sendVerification(ctx, user.ID, user.Email, "")
+}
+
+// sendVerification sends a token to address. pendingEmail is stored with the
+// token so verifying it completes an email change.
+func sendVerification(ctx context.Context, userID uint, address, pendingEmail string) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	verificationToken := models.VerificationToken{
+		UserID:    userID,
+		Token:     token,
+		Email:     pendingEmail,
+		ExpiresAt: time.Now().Add(verificationTokenTTL),
+	}
+	if err := config.DB.WithContext(ctx).Create(&verificationToken).Error; err != nil {
+		return err
+	}
+
+	// APP_BASE_URL makes the link absolute, e.g. https://auth.example.com.
+	link := verificationConfig.AppBaseURL + "/api/auth/verify?token=" + token
+	body := fmt.Sprintf("Confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.", link, verificationTokenTTL)
+	return Mail.Send(address, "Verify your email address", body)
+}
+
+// EmailChangeMode is EMAIL_CHANGE_MODE. In "pending" mode (the default) the old
+// address stays active and verified until the new one is verified; in "block"
+// mode the address is replaced right away and marked unverified.
+func EmailChangeMode() string {
+	return verificationConfig.EmailChangeMode
+}
+
+// ChangeEmail starts an email change according to EmailChangeMode and sends a
+// verification token to the new address. Tokens issued earlier for the user
+// are dropped, so only the latest change can be confirmed. It returns
+// ErrEmailExists when another account uses the address.
+func ChangeEmail(ctx context.Context, user *models.User, email string) error {
+	if strings.EqualFold(email, user.Email) {
+		return ErrEmailUnchanged
+	}
+
+	var taken int64
+	if err := config.DB.WithContext(ctx).Unscoped().Model(&models.User{}).Where("LOWER(email) = LOWER(?) AND id <> ?", email, user.ID).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrEmailExists
+	}
+
+	fields := map[string]any{"pending_email": email}
+	if EmailChangeMode() == EmailChangeBlock {
+		fields = map[string]any{"email": email, "email_verified": false, "pending_email": ""}
+	}
+	err := Transaction(ctx, func(tx Stores) error {
+		if err := tx.Users.Update(ctx, user, fields); err != nil {
+			return createUserError(err)
+		}
+		return tx.DB.Where("user_id = ?", user.ID).Delete(&models.VerificationToken{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if EmailChangeMode() == EmailChangeBlock {
+		return sendVerification(ctx, user.ID, email, "")
+	}
+	return sendVerification(ctx, user.ID, email, email)
+}
+
+func VerifyEmail(ctx context.Context, token string) error {
+	var verificationToken models.VerificationToken
+	if err := config.DB.WithContext(ctx).Where("token = ? AND expires_at > ?", token, time.Now()).First(&verificationToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+
+	fields := map[string]any{"email_verified": true}
+	if verificationToken.Email != "" {
+		fields["email"] = verificationToken.Email
+		fields["pending_email"] = ""
+	}
+
+	return Transaction(ctx, func(tx Stores) error {
+		// The new address may have been taken since the change was requested.
+		if err := tx.DB.Model(&models.User{}).Where("id = ?", verificationToken.UserID).Updates(fields).Error; err != nil {
+			return createUserError(err)
+		}
+
+		return tx.DB.Where("user_id = ?", verificationToken.UserID).Delete(&models.VerificationToken{}).Error
+	})
+}
+
+func EmailVerificationRequired() bool {
+	return verificationConfig.Required
+}
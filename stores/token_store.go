@@ -0,0 +1,97 @@
+package stores
+
+import (
+	"context"
+	"jwt-poc/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenStore persists refresh tokens. A token is active while it is neither
+// revoked nor expired.
+type TokenStore interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (models.RefreshToken, error)
+	FindByID(ctx context.Context, id uint) (models.RefreshToken, error)
+	Update(ctx context.Context, token *models.RefreshToken, fields map[string]any) error
+	// Revoke reports whether it revoked the token, false if it already was.
+	Revoke(ctx context.Context, id uint, now time.Time) (bool, error)
+	// ListActive returns the user's active tokens, newest first.
+	ListActive(ctx context.Context, userID uint, now time.Time) ([]models.RefreshToken, error)
+	DeleteByIDs(ctx context.Context, ids []uint) error
+	DeleteByHash(ctx context.Context, hash string) error
+	DeleteUnrevoked(ctx context.Context, userID, id uint) (int64, error)
+	DeleteAllUnrevoked(ctx context.Context, userID uint) (int64, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type GormTokenStore struct {
+	db *gorm.DB
+}
+
+func NewGormTokenStore(db *gorm.DB) *GormTokenStore {
+	return &GormTokenStore{db: db}
+}
+
+func (s *GormTokenStore) Create(ctx context.Context, token *models.RefreshToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+func (s *GormTokenStore) FindByHash(ctx context.Context, hash string) (models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	err := s.db.WithContext(ctx).Where("token = ?", hash).First(&refreshToken).Error
+	return refreshToken, err
+}
+
+func (s *GormTokenStore) FindByID(ctx context.Context, id uint) (models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	err := s.db.WithContext(ctx).First(&refreshToken, id).Error
+	return refreshToken, err
+}
+
+func (s *GormTokenStore) Update(ctx context.Context, token *models.RefreshToken, fields map[string]any) error {
+	return s.db.WithContext(ctx).Model(token).Updates(fields).Error
+}
+
+// Revoke is conditional on revoked_at, so of concurrent rotations of one token
+// only one succeeds.
+func (s *GormTokenStore) Revoke(ctx context.Context, id uint, now time.Time) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]any{"last_used_at": now, "revoked_at": now})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (s *GormTokenStore) ListActive(ctx context.Context, userID uint, now time.Time) ([]models.RefreshToken, error) {
+	tokens := []models.RefreshToken{}
+	err := s.db.WithContext(ctx).Where("user_id = ? AND revoked_at IS NULL AND expiry_date > ?", userID, now).
+		Order("created_at DESC, id DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (s *GormTokenStore) DeleteByIDs(ctx context.Context, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Delete(&models.RefreshToken{}, ids).Error
+}
+
+func (s *GormTokenStore) DeleteByHash(ctx context.Context, hash string) error {
+	return s.db.WithContext(ctx).Where("token = ?", hash).Delete(&models.RefreshToken{}).Error
+}
+
+func (s *GormTokenStore) DeleteUnrevoked(ctx context.Context, userID, id uint) (int64, error) {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *GormTokenStore) DeleteAllUnrevoked(ctx context.Context, userID uint) (int64, error) {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND revoked_at IS NULL", userID).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *GormTokenStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("expiry_date < ?", now).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
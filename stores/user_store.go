@@ -0,0 +1,67 @@
+package stores
+
+import (
+	"context"
+	"jwt-poc/models"
+
+	"gorm.io/gorm"
+)
+
+// UserStore is the user persistence behind the auth and user flows. Lookups
+// return gorm.ErrRecordNotFound for missing or soft-deleted users.
+type UserStore interface {
+	FindByID(ctx context.Context, id uint) (models.User, error)
+	FindByUsername(ctx context.Context, username string, tenantID uint) (models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, user *models.User, fields map[string]any) error
+	IncrementFailedAttempts(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id uint) (int64, error)
+	Purge(ctx context.Context, id uint) (int64, error)
+}
+
+type GormUserStore struct {
+	db *gorm.DB
+}
+
+func NewGormUserStore(db *gorm.DB) *GormUserStore {
+	return &GormUserStore{db: db}
+}
+
+func (s *GormUserStore) FindByID(ctx context.Context, id uint) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).First(&user, id).Error
+	return user, err
+}
+
+func (s *GormUserStore) FindByUsername(ctx context.Context, username string, tenantID uint) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("username = ? AND tenant_id = ?", username, tenantID).First(&user).Error
+	return user, err
+}
+
+func (s *GormUserStore) Create(ctx context.Context, user *models.User) error {
+	return s.db.WithContext(ctx).Create(user).Error
+}
+
+func (s *GormUserStore) Update(ctx context.Context, user *models.User, fields map[string]any) error {
+	return s.db.WithContext(ctx).Model(user).Updates(fields).Error
+}
+
+// IncrementFailedAttempts bumps the counter in SQL so concurrent failures
+// aren't lost.
+func (s *GormUserStore) IncrementFailedAttempts(ctx context.Context, user *models.User) error {
+	return s.db.WithContext(ctx).Model(user).UpdateColumn("failed_attempts", gorm.Expr("failed_attempts + 1")).Error
+}
+
+// Delete soft-deletes the user and reports how many rows were affected.
+func (s *GormUserStore) Delete(ctx context.Context, id uint) (int64, error) {
+	result := s.db.WithContext(ctx).Delete(&models.User{}, id)
+	return result.RowsAffected, result.Error
+}
+
+// Purge removes the user row, soft-deleted or not, and reports how many rows
+// were affected. The database cascades it to the rows the user owns.
+func (s *GormUserStore) Purge(ctx context.Context, id uint) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().Delete(&models.User{}, id)
+	return result.RowsAffected, result.Error
+}
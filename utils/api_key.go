@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// GenerateApiKey returns a raw key in the form "<prefix>.<secret>". Only the
+// prefix is stored in plaintext; the full key is shown to the client once.
+func GenerateApiKey() (string, error) {
+	prefix := make([]byte, 4)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(prefix) + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeySchemes are auth scheme prefixes that clients paste in front of the key.
+var apiKeySchemes = []string{"Bearer", "ApiKey", "Api-Key"}
+
+// NormalizeApiKey trims whitespace around a key copied from a dashboard and
+// drops a leading scheme such as "Bearer ", matched case-insensitively. The key
+// itself is left as is; it is case-sensitive.
+func NormalizeApiKey(raw string) string {
+	key := strings.TrimSpace(raw)
+	for _, scheme := range apiKeySchemes {
+		if len(key) > len(scheme) && strings.EqualFold(key[:len(scheme)], scheme) && (key[len(scheme)] == ' ' || key[len(scheme)] == '\t') {
+			return strings.TrimSpace(key[len(scheme):])
+		}
+	}
+	return key
+}
+
+func ApiKeyPrefix(key string) string {
+	prefix, _, found := strings.Cut(key, ".")
+	if !found {
+		return ""
+	}
+	return prefix
+}
+
+// ScopeCovers reports whether granted, a space-delimited scope as in OAuth,
+// contains every scope in required.
+func ScopeCovers(granted string, required ...string) bool {
+	scopes := strings.Fields(granted)
+	for _, scope := range required {
+		if !slices.Contains(scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestNormalizeApiKey(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"plain", "abc.DEF123", "abc.DEF123"},
+		{"padded", "  abc.DEF123\t\n", "abc.DEF123"},
+		{"bearer", "Bearer abc.DEF123", "abc.DEF123"},
+		{"lowercase scheme", "bearer abc.DEF123", "abc.DEF123"},
+		{"ApiKey scheme", "ApiKey abc.DEF123", "abc.DEF123"},
+		{"Api-Key scheme with tab", "API-KEY\tabc.DEF123", "abc.DEF123"},
+		{"scheme and padding", "  Bearer   abc.DEF123  ", "abc.DEF123"},
+		{"scheme without separator", "Bearerabc.DEF123", "Bearerabc.DEF123"},
+		{"scheme only", "Bearer", "Bearer"},
+		{"key case kept", "ABC.def123", "ABC.def123"},
+		{"empty", "   ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeApiKey(tt.raw); got != tt.want {
+				t.Errorf("NormalizeApiKey(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
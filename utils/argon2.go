@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix starts every argon2id hash, which is stored in the PHC string
+// format: $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>.
+const argon2idPrefix = "$argon2id$"
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+var errInvalidArgon2Hash = errors.New("invalid argon2id hash")
+
+// argon2idParams are used for new hashes; see loadArgon2idParams. The default
+// is the RFC 9106 second recommended option.
+var argon2idParams = argon2Params{memory: 64 * 1024, time: 3, threads: 4, keyLen: 32, saltLen: 16}
+
+// loadArgon2idParams reads ARGON2_MEMORY (KiB), ARGON2_TIME and
+// ARGON2_THREADS. Out-of-range values are errors, as argon2.IDKey panics on 0
+// threads and a wrapped-around value would be silently wrong.
+func loadArgon2idParams() (argon2Params, error) {
+	memory, err := envIntInRange("ARGON2_MEMORY", 64*1024, 8, 4*1024*1024)
+	if err != nil {
+		return argon2Params{}, err
+	}
+	passes, err := envIntInRange("ARGON2_TIME", 3, 1, 100)
+	if err != nil {
+		return argon2Params{}, err
+	}
+	threads, err := envIntInRange("ARGON2_THREADS", 4, 1, 255)
+	if err != nil {
+		return argon2Params{}, err
+	}
+
+	// argon2 needs 8 KiB per thread; it would raise a lower memory silently.
+	if memory < 8*threads {
+		return argon2Params{}, fmt.Errorf("ARGON2_MEMORY must be at least 8 KiB per thread (%d for ARGON2_THREADS=%d)", 8*threads, threads)
+	}
+
+	return argon2Params{memory: uint32(memory), time: uint32(passes), threads: uint8(threads), keyLen: 32, saltLen: 16}, nil
+}
+
+func envIntInRange(key string, fallback, min, max int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min || parsed > max {
+		return 0, fmt.Errorf("invalid %s %q (expected an integer from %d to %d)", key, value, min, max)
+	}
+	return parsed, nil
+}
+
+func hashArgon2id(password string, p argon2Params) (string, error) {
+	salt := make([]byte, p.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkArgon2id verifies with the parameters stored in the hash, so changing
+// ARGON2_* doesn't break existing hashes.
+func checkArgon2id(password, hash string) bool {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil || p.time == 0 || p.threads == 0 {
+		return argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	p.saltLen = uint32(len(salt))
+	p.keyLen = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ErrUnknownClient is returned for a client that has no audience configured.
+var ErrUnknownClient = errors.New("unknown client")
+
+// loadAudiences reads the per-client audiences.
+//
+// JWT_CLIENT_AUDIENCES maps clients to the audience of their tokens, as
+// comma-separated client=audience pairs. A login naming one of these clients
+// gets an access token for that audience only, so it is refused by resource
+// servers that serve other clients.
+//
+// JWT_ACCEPTED_AUDIENCES lists the audiences this service accepts. A token is
+// valid when its aud contains any of them. It defaults to JWT_AUDIENCE, and
+// when neither is set aud isn't checked.
+func (cfg *JWTConfig) loadAudiences() error {
+	cfg.ClientAudiences = map[string]string{}
+	for _, pair := range splitList(os.Getenv("JWT_CLIENT_AUDIENCES")) {
+		client, audience, found := strings.Cut(pair, "=")
+		client, audience = strings.TrimSpace(client), strings.TrimSpace(audience)
+		if !found || client == "" || audience == "" {
+			return fmt.Errorf("invalid JWT_CLIENT_AUDIENCES entry %q (expected client=audience)", pair)
+		}
+		cfg.ClientAudiences[client] = audience
+	}
+
+	cfg.AcceptedAudiences = splitList(os.Getenv("JWT_ACCEPTED_AUDIENCES"))
+	if len(cfg.AcceptedAudiences) == 0 && cfg.Audience != "" {
+		cfg.AcceptedAudiences = []string{cfg.Audience}
+	}
+	return nil
+}
+
+// ClientAudience is the audience of access tokens issued to client. No client
+// gets JWT_AUDIENCE.
+func ClientAudience(client string) (string, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return "", err
+	}
+	if client == "" {
+		return cfg.Audience, nil
+	}
+	audience, ok := cfg.ClientAudiences[client]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownClient, client)
+	}
+	return audience, nil
+}
+
+// ClientAccepted reports whether this service accepts the audience of client,
+// for credentials such as API keys that name a client but carry no aud. A
+// client without a configured audience is accepted.
+func ClientAccepted(client string) bool {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return false
+	}
+	audience, ok := cfg.ClientAudiences[client]
+	if !ok || len(cfg.AcceptedAudiences) == 0 {
+		return true
+	}
+	return slices.Contains(cfg.AcceptedAudiences, audience)
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
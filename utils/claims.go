@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClaimsLocalsKey is the c.Locals key AuthMiddleware stores the parsed JWT claims under.
+const ClaimsLocalsKey = "claims"
+
+var (
+	ErrClaimsNotFound    = errors.New("claims not found in context")
+	ErrInvalidClaimsType = errors.New("claims in context have an unexpected type")
+)
+
+func GetClaims(c *fiber.Ctx) (*Claims, error) {
+	value := c.Locals(ClaimsLocalsKey)
+	if value == nil {
+		return nil, ErrClaimsNotFound
+	}
+
+	claims, ok := value.(*Claims)
+	if !ok {
+		return nil, ErrInvalidClaimsType
+	}
+	return claims, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CookieConfig names the auth cookies and sets their Secure and SameSite
+// attributes; see SetCookieConfig.
+type CookieConfig struct {
+	AccessTokenName  string
+	RefreshTokenName string
+	// RefreshTokenPath scopes the refresh token cookie.
+	RefreshTokenPath string
+	Secure           bool
+	SameSite         string
+}
+
+var cookieConfig = CookieConfig{
+	AccessTokenName:  "access_token",
+	RefreshTokenName: "refresh_token",
+	RefreshTokenPath: "/api/auth",
+	Secure:           true,
+	SameSite:         fiber.CookieSameSiteStrictMode,
+}
+
+// SetCookieConfig applies ACCESS_TOKEN_COOKIE_NAME, REFRESH_TOKEN_COOKIE_NAME,
+// REFRESH_TOKEN_COOKIE_PATH, COOKIE_SECURE and COOKIE_SAMESITE once at
+// startup; config.Load has already checked them.
+func SetCookieConfig(cfg CookieConfig) {
+	cookieConfig = cfg
+}
+
+func AccessTokenCookieName() string {
+	return cookieConfig.AccessTokenName
+}
+
+func RefreshTokenCookieName() string {
+	return cookieConfig.RefreshTokenName
+}
+
+// NewRefreshTokenCookie is scoped to REFRESH_TOKEN_COOKIE_PATH, /api/auth by
+// default, so the refresh token is only sent to the endpoints that use it.
+func NewRefreshTokenCookie(value string, expires time.Time) *fiber.Cookie {
+	cookie := NewAuthCookie(RefreshTokenCookieName(), value, expires)
+	cookie.Path = cookieConfig.RefreshTokenPath
+	return cookie
+}
+
+// NewAuthCookie builds an HttpOnly cookie for auth tokens. Secure defaults to
+// true (COOKIE_SECURE) and SameSite to Strict (COOKIE_SAMESITE).
+func NewAuthCookie(name, value string, expires time.Time) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   cookieConfig.Secure,
+		SameSite: cookieConfig.SameSite,
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Refresh token binding modes selected with REFRESH_TOKEN_BINDING.
+const (
+	BindingOff       = "off"
+	BindingUserAgent = "user-agent"
+	BindingUAIP      = "ua+ip"
+)
+
+var refreshTokenBinding = BindingOff
+
+// ClientFingerprint identifies the client a refresh token was issued to. Only
+// hashes are kept. The IP is reduced to its /24 (IPv4) or /64 (IPv6) network
+// first, so moving between addresses of the same network still matches.
+type ClientFingerprint struct {
+	UserAgentHash string
+	IPHash        string
+}
+
+func NewClientFingerprint(userAgent, ip string) ClientFingerprint {
+	return ClientFingerprint{
+		UserAgentHash: fingerprintHash(userAgent),
+		IPHash:        fingerprintHash(ipNetwork(ip)),
+	}
+}
+
+// LoadRefreshTokenBinding reads REFRESH_TOKEN_BINDING (off, user-agent or
+// ua+ip) once at startup. Fingerprints are always recorded, so strictness can
+// be raised later without logging everyone out.
+func LoadRefreshTokenBinding() error {
+	switch mode := os.Getenv("REFRESH_TOKEN_BINDING"); mode {
+	case "":
+		refreshTokenBinding = BindingOff
+	case BindingOff, BindingUserAgent, BindingUAIP:
+		refreshTokenBinding = mode
+	default:
+		return fmt.Errorf("unsupported REFRESH_TOKEN_BINDING %q (expected %s, %s or %s)", mode, BindingOff, BindingUserAgent, BindingUAIP)
+	}
+	return nil
+}
+
+func RefreshTokenBinding() string {
+	return refreshTokenBinding
+}
+
+// Matches compares fp with the fingerprint stored at issuance under the
+// configured mode. Tokens issued before fingerprints were recorded have empty
+// hashes and always match.
+func (fp ClientFingerprint) Matches(issued ClientFingerprint) bool {
+	switch refreshTokenBinding {
+	case BindingUserAgent:
+		return issued.UserAgentHash == "" || fp.UserAgentHash == issued.UserAgentHash
+	case BindingUAIP:
+		return (issued.UserAgentHash == "" || fp.UserAgentHash == issued.UserAgentHash) &&
+			(issued.IPHash == "" || fp.IPHash == issued.IPHash)
+	}
+	return true
+}
+
+func ipNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String()
+}
+
+func fingerprintHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,13 +1,125 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultPasswordMinLength = 8
+	DefaultBcryptCost        = 12
+)
+
+// PasswordMaxBytes is bcrypt's input limit; anything longer would be silently
+// truncated.
+const PasswordMaxBytes = 72
+
+const (
+	HashAlgoBcrypt   = "bcrypt"
+	HashAlgoArgon2id = "argon2id"
+)
+
+var bcryptCost = DefaultBcryptCost
+
+var passwordHashAlgo = HashAlgoBcrypt
+
+// dummyHash is what DummyPasswordCheck compares against; see PrepareDummyHash.
+var dummyHash string
+
+// SetBcryptCost sets the cost of new bcrypt hashes at startup; config.Load
+// checks that BCRYPT_COST is in bcrypt's range.
+func SetBcryptCost(cost int) {
+	bcryptCost = cost
+	log.Printf("bcrypt cost: %d", bcryptCost)
+}
+
+// LoadPasswordHashAlgo reads PASSWORD_HASH_ALGO (bcrypt or argon2id) and the
+// ARGON2_* parameters once at startup. It only decides how new hashes are made;
+// CheckPasswordHash accepts either kind.
+func LoadPasswordHashAlgo() error {
+	algo := os.Getenv("PASSWORD_HASH_ALGO")
+	switch algo {
+	case "":
+		algo = HashAlgoBcrypt
+	case HashAlgoBcrypt, HashAlgoArgon2id:
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASH_ALGO %q (expected bcrypt or argon2id)", algo)
+	}
+
+	params, err := loadArgon2idParams()
+	if err != nil {
+		return err
+	}
+
+	passwordHashAlgo = algo
+	argon2idParams = params
+	log.Printf("password hash algorithm: %s", passwordHashAlgo)
+	return nil
+}
+
+func PasswordHashAlgo() string {
+	return passwordHashAlgo
+}
 
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	if passwordHashAlgo == HashAlgoArgon2id {
+		return hashArgon2id(password, argon2idParams)
+	}
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	return string(bytes), err
 }
 
+// CheckPasswordHash picks the algorithm from the hash prefix, so bcrypt and
+// argon2id hashes can coexist while users migrate.
 func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		return checkArgon2id(password, hash)
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// PasswordNeedsRehash reports whether hash was made with a different algorithm
+// or different parameters than HashPassword would use now.
+func PasswordNeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		if passwordHashAlgo != HashAlgoArgon2id {
+			return true
+		}
+		p, _, _, err := decodeArgon2id(hash)
+		current := argon2idParams
+		return err != nil || p.memory != current.memory || p.time != current.time || p.threads != current.threads
+	}
+
+	if passwordHashAlgo != HashAlgoBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != bcryptCost
+}
+
+// PrepareDummyHash makes the fixed hash for DummyPasswordCheck with the
+// configured algorithm and cost. main calls it at startup, once both are set,
+// so that no login pays for making it.
+func PrepareDummyHash() error {
+	hash, err := HashPassword("dummy-password")
+	if err != nil {
+		return err
+	}
+	dummyHash = hash
+	return nil
+}
+
+// DummyPasswordCheck performs a password comparison against the fixed hash and
+// discards the result. Calling it when a user does not exist makes that path
+// cost about as much as a real password check, so response timing does not
+// reveal which usernames are registered.
+func DummyPasswordCheck(password string) {
+	_ = CheckPasswordHash(password, dummyHash)
+}
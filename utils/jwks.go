@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jwksFetchTimeout = 5 * time.Second
+	jwksMaxBodyBytes = 1 << 20
+	// jwksMinRefreshInterval stops tokens with made-up kids from turning into
+	// a stream of requests to the issuer.
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+var ErrUnknownKID = errors.New("no JWKS key for kid")
+
+// JWKSCache holds the RS256 keys published at a JWKS URL, by kid. Keys are
+// refreshed every TTL by Run and on demand when a token names an unknown kid.
+// A failed fetch keeps the keys already cached; a kid that was never fetched
+// is refused, never accepted.
+type JWKSCache struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	lastAttempt time.Time
+
+	// fetchMu lets only one fetch run at a time.
+	fetchMu sync.Mutex
+}
+
+func NewJWKSCache(url string, ttl time.Duration) *JWKSCache {
+	return &JWKSCache{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		keys:   map[string]*rsa.PublicKey{},
+	}
+}
+
+// Key returns the key for kid, fetching the JWKS again when kid is unknown.
+func (c *JWKSCache) Key(kid string) (*rsa.PublicKey, error) {
+	if key, ok := c.cached(kid); ok {
+		return key, nil
+	}
+
+	if err := c.refresh(false); err != nil {
+		log.Printf("failed to fetch JWKS from %s: %v", c.url, err)
+	}
+	if key, ok := c.cached(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKID, kid)
+}
+
+// Run refreshes the keys every TTL until ctx is cancelled, starting right away.
+func (c *JWKSCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
+	for {
+		if err := c.refresh(true); err != nil {
+			log.Printf("failed to refresh JWKS from %s, keeping cached keys: %v", c.url, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *JWKSCache) cached(kid string) (*rsa.PublicKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the JWKS unless another fetch ran within
+// jwksMinRefreshInterval; scheduled refreshes skip that check. Callers that
+// queued behind a fetch reuse its result.
+func (c *JWKSCache) refresh(scheduled bool) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	c.mu.RLock()
+	recent := time.Since(c.lastAttempt) < jwksMinRefreshInterval
+	c.mu.RUnlock()
+	if recent && !scheduled {
+		return nil
+	}
+
+	keys, err := c.fetch()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAttempt = time.Now()
+	if err != nil {
+		return err
+	}
+	c.keys = keys
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (c *JWKSCache) fetch() (map[string]*rsa.PublicKey, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxBodyBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") || (jwk.Alg != "" && jwk.Alg != AlgRS256) {
+			continue
+		}
+		key, err := jwk.rsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	// An empty set would drop every cached key, so treat it as a failure.
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no RS256 signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	if len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+}
+
+// StartJWKSRefresh runs the background refresh of every trusted issuer's JWKS
+// until ctx is cancelled.
+func StartJWKSRefresh(ctx context.Context) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return
+	}
+	for _, issuer := range cfg.TrustedIssuers {
+		if issuer.jwks != nil {
+			go issuer.jwks.Run(ctx)
+		}
+	}
+}
@@ -1,42 +1,442 @@
 package utils
 
 import (
-	"os"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// Claims are the access token claims. Extra holds any non-standard claims
+// issued through GenerateAccessTokenWithClaims; they are written at the top
+// level of the token, next to user_id and role.
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID uint           `json:"user_id"`
+	Role   string         `json:"role"`
+	Extra  map[string]any `json:"-"`
+	// Compact marshals with the short claim names; see compactClaimNames.
+	Compact bool `json:"-"`
+	// External is set by ValidateJWT on tokens from a TrustedIssuer, which
+	// name no local user.
+	External bool `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// knownClaims is Claims without its JSON methods.
+type knownClaims Claims
+
+var knownClaimNames = []string{"user_id", "role", "iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// isReservedClaim reports whether extras can't be issued under name: the known
+// claims, the act claim only GenerateImpersonationToken sets, and the short
+// names, which read back as the claims they stand for.
+func isReservedClaim(name string) bool {
+	if name == "act" || slices.Contains(knownClaimNames, name) {
+		return true
+	}
+	for _, short := range compactClaimNames {
+		if name == short {
+			return true
+		}
+	}
+	return false
+}
+
+// issuableExtras is extra without the reserved claims; see isReservedClaim.
+func issuableExtras(extra map[string]any) map[string]any {
+	if len(extra) == 0 {
+		return nil
+	}
+	issuable := make(map[string]any, len(extra))
+	for name, value := range extra {
+		if !isReservedClaim(name) {
+			issuable[name] = value
+		}
+	}
+	return issuable
+}
+
+// compactClaimNames maps claim names to the short names used with JWT_COMPACT.
+// Measured on an HS256 token with user_id, role "admin", tenant_id, jti and
+// exp, the payload shrinks from 106 to 93 JSON bytes and the encoded token from
+// 223 to 205 bytes (about 8%). Tokens in either form are accepted.
+var compactClaimNames = map[string]string{
+	"user_id":        "uid",
+	"role":           "r",
+	"tenant_id":      "tid",
+	"email_verified": "ev",
+	"is_admin":       "adm",
+}
+
+// TenantID reads the tenant_id claim. Tokens issued before tenants existed
+// belong to the default tenant 0.
+func (c *Claims) TenantID() uint {
+	switch v := c.Extra["tenant_id"].(type) {
+	case uint:
+		return v
+	case float64:
+		if v >= 0 {
+			return uint(v)
+		}
+	}
+	return 0
+}
+
+// EmailVerified and IsAdmin read convenience claims copied from the user when
+// the token was issued. They can be stale for up to ACCESS_TOKEN_TTL, so use
+// them for cheap checks only and load the user where that matters.
+func (c *Claims) EmailVerified() bool {
+	verified, _ := c.Extra["email_verified"].(bool)
+	return verified
+}
+
+func (c *Claims) IsAdmin() bool {
+	isAdmin, _ := c.Extra["is_admin"].(bool)
+	return isAdmin
+}
+
+// ActorID reads the user id in the RFC 8693 act claim of an impersonation
+// token, the admin acting as UserID. It is 0 for ordinary tokens.
+func (c *Claims) ActorID() uint {
+	act, _ := c.Extra["act"].(map[string]any)
+	sub, _ := act["sub"].(string)
+	actorID, err := strconv.ParseUint(sub, 10, 0)
+	if err != nil {
+		return 0
+	}
+	return uint(actorID)
+}
+
+func (c Claims) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal(knownClaims(c))
+	if err != nil || (len(c.Extra) == 0 && !c.Compact) {
+		return known, err
+	}
+
+	merged := map[string]json.RawMessage{}
+	for name, value := range c.Extra {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid claim %q: %w", name, err)
+		}
+		merged[name] = raw
+	}
+	// Known claims are applied last so extras can never override them.
+	if err := json.Unmarshal(known, &merged); err != nil {
+		return nil, err
+	}
+	if c.Compact {
+		for name, short := range compactClaimNames {
+			if value, ok := merged[name]; ok {
+				merged[short] = value
+				delete(merged, name)
+			}
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	data, err := expandCompactClaims(data)
+	if err != nil {
+		return err
+	}
+
+	var known knownClaims
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+
+	extra := map[string]any{}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	for _, name := range knownClaimNames {
+		delete(extra, name)
+	}
+
+	*c = Claims(known)
+	if len(extra) > 0 {
+		c.Extra = extra
+	}
+	return nil
+}
+
+// expandCompactClaims renames short claim names back to the full ones. A full
+// name that is also present wins.
+func expandCompactClaims(data []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	renamed := false
+	for name, short := range compactClaimNames {
+		value, ok := raw[short]
+		if !ok {
+			continue
+		}
+		if _, exists := raw[name]; !exists {
+			raw[name] = value
+		}
+		delete(raw, short)
+		renamed = true
+	}
+	if !renamed {
+		return data, nil
+	}
+	return json.Marshal(raw)
+}
+
+// AccessTokenTTL is the lifetime of issued access tokens. main sets it from
+// ACCESS_TOKEN_TTL at startup.
+var AccessTokenTTL = 15 * time.Minute
+
+// GenerateAccessToken signs with the configured JWT_ALG.
 func GenerateAccessToken(userID uint, role string) (string, error) {
-	expiratonTime := time.Now().Add(15 * time.Minute)
-	claims := &Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiratonTime),
-		},
+	return GenerateAccessTokenWithClaims(userID, role, nil)
+}
+
+// GenerateAccessTokenWithClaims is GenerateAccessToken with extra claims such
+// as a tenant ID. Extras named like a registered or reserved claim, such as
+// nbf or act, are dropped.
+func GenerateAccessTokenWithClaims(userID uint, role string, extra map[string]any) (string, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return "", err
+	}
+	return GenerateAccessTokenForAudience(userID, role, cfg.Audience, extra)
+}
+
+// GenerateAccessTokenForAudience is GenerateAccessTokenWithClaims with aud set
+// to audience instead of JWT_AUDIENCE; see ClientAudience.
+func GenerateAccessTokenForAudience(userID uint, role, audience string, extra map[string]any) (string, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return "", err
+	}
+
+	claims := newClaims(cfg, userID, role)
+	claims.Audience = nil
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	claims.Extra = issuableExtras(extra)
+	return signToken(cfg, cfg.Algorithm, claims, "")
+}
+
+// ImpersonationTokenTTL is the lifetime of impersonation tokens. main sets it
+// from IMPERSONATION_TOKEN_TTL, which can't exceed ACCESS_TOKEN_TTL.
+var ImpersonationTokenTTL = 5 * time.Minute
+
+// GenerateImpersonationToken issues an access token for userID that names
+// actorID in its act claim and expires after ImpersonationTokenTTL.
+func GenerateImpersonationToken(userID uint, role string, actorID uint, extra map[string]any) (string, time.Time, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := newClaims(cfg, userID, role)
+	expiresAt := time.Now().Add(ImpersonationTokenTTL)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.Extra = issuableExtras(extra)
+	if claims.Extra == nil {
+		claims.Extra = map[string]any{}
+	}
+	claims.Extra["act"] = map[string]any{"sub": strconv.FormatUint(uint64(actorID), 10)}
+	token, err := signToken(cfg, cfg.Algorithm, claims, "")
+	return token, expiresAt, err
+}
+
+func GenerateAccessTokenRS256(userID uint, role string) (string, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return "", err
+	}
+	return signToken(cfg, AlgRS256, newClaims(cfg, userID, role), "")
+}
+
+// signToken signs claims with alg. typ, when set, goes into the header to tell
+// token kinds apart.
+func signToken(cfg *JWTConfig, alg string, claims jwt.Claims, typ string) (string, error) {
+	var token *jwt.Token
+	var key interface{}
+	switch alg {
+	case AlgRS256:
+		if cfg.PrivateKey == nil {
+			return "", errors.New("no RS256 private key configured")
+		}
+		token, key = jwt.NewWithClaims(jwt.SigningMethodRS256, claims), cfg.PrivateKey
+	case AlgEdDSA:
+		if cfg.EdPrivateKey == nil {
+			return "", errors.New("no EdDSA private key configured")
+		}
+		token, key = jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims), cfg.EdPrivateKey
+	default:
+		kid, secretKey := cfg.hmacSigningKey()
+		token, key = jwt.NewWithClaims(jwt.SigningMethodHS256, claims), secretKey
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+	}
+
+	if typ != "" {
+		token.Header["typ"] = typ
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secretKey := []byte(os.Getenv("SECRET_KEY"))
-	return token.SignedString(secretKey)
+	return token.SignedString(key)
 }
 
+// ValidateJWT only accepts the algorithms in JWT_ACCEPTED_ALGS, and each one
+// only with its own kind of key, so an RS256 public key can never be reused as
+// an HMAC secret. Refresh JWTs are refused. Tokens from a trusted external
+// issuer are verified with that issuer's key instead; see TrustedIssuer.
 func ValidateJWT(signedToken string) (*Claims, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectAlgNone(signedToken); err != nil {
+		return nil, err
+	}
+
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(signedToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("SECRET_KEY")), nil
-	})
+	if issuer := cfg.trustedIssuerFor(signedToken); issuer != nil {
+		if _, err := parseJWT(signedToken, claims, issuer.verificationKey, issuer.parserOptions(cfg)); err != nil {
+			return nil, err
+		}
+		issuer.localize(claims)
+		return claims, nil
+	}
+
+	token, err := parseJWT(signedToken, claims, cfg.verificationKey, cfg.parserOptions(cfg.AcceptedAudiences))
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := token.Header["typ"].(string); typ == RefreshJWTType {
+		return nil, fmt.Errorf("%w: refresh token used as access token", jwt.ErrTokenInvalidClaims)
+	}
+	return claims, nil
+}
+
+// JWTInspection is what InspectJWT found in a token.
+type JWTInspection struct {
+	Header map[string]any `json:"header"`
+	Claims map[string]any `json:"claims"`
+	// SignatureValid is true when the signature was verified, even if the
+	// claims were then rejected.
+	SignatureValid bool `json:"signature_valid"`
+	// Expired reads exp without trusting the token.
+	Expired bool `json:"expired"`
+	// Valid means ValidateJWT accepts the token; Error says why not.
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// InspectJWT decodes a token without requiring it to be valid, for debugging.
+// It only fails for a token that can't be decoded at all.
+func InspectJWT(signedToken string) (JWTInspection, error) {
+	claims := jwt.MapClaims{}
+	token, _, err := jwt.NewParser().ParseUnverified(signedToken, claims)
 	if err != nil {
+		return JWTInspection{}, err
+	}
+
+	inspection := JWTInspection{Header: token.Header, Claims: claims}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		inspection.Expired = !exp.After(time.Now())
+	}
+
+	_, err = ValidateJWT(signedToken)
+	inspection.Valid = err == nil
+	// The signature is verified before the claims, so a claims error means
+	// it checked out.
+	inspection.SignatureValid = err == nil || errors.Is(err, jwt.ErrTokenInvalidClaims)
+	if err != nil {
+		inspection.Error = err.Error()
+	}
+	return inspection, nil
+}
+
+// parserOptions are the checks for tokens we issued. The aud has to contain
+// one of audiences, unless there are none.
+func (cfg *JWTConfig) parserOptions(audiences []string) []jwt.ParserOption {
+	options := []jwt.ParserOption{jwt.WithValidMethods(cfg.acceptedAlgs())}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if len(audiences) > 0 {
+		options = append(options, jwt.WithAudience(audiences...))
+	}
+	return options
+}
+
+func parseJWT(signedToken string, claims jwt.Claims, keyFunc jwt.Keyfunc, options []jwt.ParserOption) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(signedToken, claims, keyFunc, options...)
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+			return nil, fmt.Errorf("invalid issuer: %w", err)
+		case errors.Is(err, jwt.ErrTokenInvalidAudience):
+			return nil, fmt.Errorf("invalid audience: %w", err)
+		}
 		return nil, err
 	}
 	if !token.Valid {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
-	return claims, nil
+	return token, nil
+}
+
+// ErrAlgNone is returned for unsigned tokens. The allowlist would refuse them
+// anyway; checking first makes the reason explicit and independent of it.
+var ErrAlgNone = errors.New(`unsigned JWT ("alg": "none") is not accepted`)
+
+// rejectAlgNone reads the header without trusting anything else in the token.
+// Undecodable headers are left for the parser to report as malformed.
+func rejectAlgNone(signedToken string) error {
+	encodedHeader, _, found := strings.Cut(signedToken, ".")
+	if !found {
+		return nil
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil {
+		return nil
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil
+	}
+	if strings.EqualFold(header.Alg, "none") {
+		return fmt.Errorf("%w: %w", jwt.ErrTokenUnverifiable, ErrAlgNone)
+	}
+	return nil
+}
+
+func newClaims(cfg *JWTConfig, userID uint, role string) *Claims {
+	expiratonTime := time.Now().Add(AccessTokenTTL)
+	claims := &Claims{
+		UserID:  userID,
+		Role:    role,
+		Compact: cfg.Compact,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    cfg.Issuer,
+			ExpiresAt: jwt.NewNumericDate(expiratonTime),
+		},
+	}
+	if cfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{cfg.Audience}
+	}
+	return claims
 }
@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minSecretBytes is the shortest HMAC secret accepted for HS256.
+const minSecretBytes = 32
+
+var errJWTConfigNotLoaded = errors.New("JWT config not loaded, call LoadJWTConfig at startup")
+
+// Signing algorithms selectable with JWT_ALG.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var supportedAlgs = []string{AlgHS256, AlgRS256, AlgEdDSA}
+
+// JWTConfig holds everything token signing and validation needs. Algorithm
+// signs new tokens; tokens signed with any of AcceptedAlgs validate, so two
+// algorithms can overlap during a migration. Keys, when set, replaces Secret
+// with a kid -> secret set and ActiveKID picks the HMAC signing key.
+type JWTConfig struct {
+	Algorithm    string
+	AcceptedAlgs []string
+	Secret       []byte
+	Keys         map[string][]byte
+	ActiveKID    string
+	PrivateKey   *rsa.PrivateKey
+	PublicKey    *rsa.PublicKey
+	EdPrivateKey ed25519.PrivateKey
+	EdPublicKey  ed25519.PublicKey
+	Issuer       string
+	// Audience is the aud of tokens issued without a client.
+	Audience string
+	// ClientAudiences and AcceptedAudiences are described at loadAudiences.
+	ClientAudiences   map[string]string
+	AcceptedAudiences []string
+	// Compact issues tokens with the short claim names from compactClaimNames.
+	Compact bool
+	// TrustedIssuers maps an external iss to the key that verifies its tokens.
+	TrustedIssuers map[string]*TrustedIssuer
+}
+
+var jwtConfig *JWTConfig
+
+// SetJWTConfig replaces the active config, e.g. to inject keys in tests.
+func SetJWTConfig(cfg JWTConfig) {
+	jwtConfig = &cfg
+}
+
+func currentJWTConfig() (*JWTConfig, error) {
+	if jwtConfig == nil {
+		return nil, errJWTConfigNotLoaded
+	}
+	return jwtConfig, nil
+}
+
+// LoadJWTConfig reads and checks the JWT settings once at startup:
+//
+//   - JWT_ALG (HS256, RS256 or EdDSA) signs new tokens. It defaults to RS256
+//     when RSA keys are configured and HS256 otherwise.
+//   - JWT_ACCEPTED_ALGS, a comma-separated allowlist, defaults to JWT_ALG.
+//   - SECRET_KEY, or JWT_KEYS with JWT_ACTIVE_KID for key rotation.
+//   - JWT_PRIVATE_KEY_PATH and JWT_PUBLIC_KEY_PATH for RS256.
+//   - JWT_ED25519_PRIVATE_KEY_PATH and JWT_ED25519_PUBLIC_KEY_PATH for EdDSA.
+//   - JWT_ISSUER and JWT_AUDIENCE.
+//   - JWT_CLIENT_AUDIENCES and JWT_ACCEPTED_AUDIENCES for per-client audiences.
+//   - JWT_TRUSTED_ISSUERS or JWT_TRUSTED_ISSUERS_FILE for external issuers.
+//
+// Every accepted algorithm needs its verification key. The HMAC secret is only
+// required when HS256 is used; an empty one is always rejected and one shorter
+// than 32 bytes only passes with ALLOW_WEAK_SECRET=true, which is meant for
+// tests.
+func LoadJWTConfig() error {
+	compact, err := envBool("JWT_COMPACT", false)
+	if err != nil {
+		return err
+	}
+	cfg := JWTConfig{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Compact:  compact,
+	}
+
+	if path := os.Getenv("JWT_PRIVATE_KEY_PATH"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT_PRIVATE_KEY_PATH: %w", err)
+		}
+		if cfg.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pem); err != nil {
+			return fmt.Errorf("invalid JWT_PRIVATE_KEY_PATH: %w", err)
+		}
+	}
+	if path := os.Getenv("JWT_PUBLIC_KEY_PATH"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT_PUBLIC_KEY_PATH: %w", err)
+		}
+		if cfg.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return fmt.Errorf("invalid JWT_PUBLIC_KEY_PATH: %w", err)
+		}
+	}
+	if path := os.Getenv("JWT_ED25519_PRIVATE_KEY_PATH"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT_ED25519_PRIVATE_KEY_PATH: %w", err)
+		}
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return fmt.Errorf("invalid JWT_ED25519_PRIVATE_KEY_PATH: %w", err)
+		}
+		cfg.EdPrivateKey = key.(ed25519.PrivateKey)
+	}
+	if path := os.Getenv("JWT_ED25519_PUBLIC_KEY_PATH"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT_ED25519_PUBLIC_KEY_PATH: %w", err)
+		}
+		key, err := jwt.ParseEdPublicKeyFromPEM(pem)
+		if err != nil {
+			return fmt.Errorf("invalid JWT_ED25519_PUBLIC_KEY_PATH: %w", err)
+		}
+		cfg.EdPublicKey = key.(ed25519.PublicKey)
+	}
+
+	if err := cfg.loadAlgorithms(); err != nil {
+		return err
+	}
+	if err := cfg.loadAudiences(); err != nil {
+		return err
+	}
+	if err := cfg.loadTrustedIssuers(); err != nil {
+		return err
+	}
+
+	allowWeak, err := envBool("ALLOW_WEAK_SECRET", false)
+	if err != nil {
+		return err
+	}
+	checkSecret := func(name, secret string) error {
+		if secret == "" {
+			return fmt.Errorf("%s is empty", name)
+		}
+		if len(secret) < minSecretBytes {
+			if !allowWeak {
+				return fmt.Errorf("%s must be at least %d bytes", name, minSecretBytes)
+			}
+			log.Printf("warning: %s is shorter than %d bytes", name, minSecretBytes)
+		}
+		return nil
+	}
+
+	if raw := os.Getenv("JWT_KEYS"); raw != "" {
+		keys := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+			return fmt.Errorf("invalid JWT_KEYS: %w", err)
+		}
+
+		if !cfg.usesAlg(AlgHS256) {
+			return errors.New("JWT_KEYS is set but HS256 is neither JWT_ALG nor in JWT_ACCEPTED_ALGS")
+		}
+		cfg.ActiveKID = os.Getenv("JWT_ACTIVE_KID")
+		if _, ok := keys[cfg.ActiveKID]; !ok {
+			return fmt.Errorf("JWT_ACTIVE_KID %q not found in JWT_KEYS", cfg.ActiveKID)
+		}
+		cfg.Keys = make(map[string][]byte, len(keys))
+		for kid, secret := range keys {
+			if err := checkSecret(fmt.Sprintf("JWT_KEYS[%q]", kid), secret); err != nil {
+				return err
+			}
+			cfg.Keys[kid] = []byte(secret)
+		}
+	} else {
+		secret := os.Getenv("SECRET_KEY")
+		if cfg.usesAlg(AlgHS256) {
+			if err := checkSecret("SECRET_KEY", secret); err != nil {
+				return err
+			}
+		}
+		cfg.Secret = []byte(secret)
+	}
+
+	SetJWTConfig(cfg)
+	return nil
+}
+
+// loadAlgorithms reads JWT_ALG and JWT_ACCEPTED_ALGS. Anything outside
+// supportedAlgs, "none" included, is refused.
+func (cfg *JWTConfig) loadAlgorithms() error {
+	cfg.Algorithm = os.Getenv("JWT_ALG")
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgHS256
+		if cfg.PrivateKey != nil || cfg.PublicKey != nil {
+			cfg.Algorithm = AlgRS256
+		}
+	}
+	if !slices.Contains(supportedAlgs, cfg.Algorithm) {
+		return fmt.Errorf("unsupported JWT_ALG %q (expected one of %s)", cfg.Algorithm, strings.Join(supportedAlgs, ", "))
+	}
+
+	cfg.AcceptedAlgs = []string{cfg.Algorithm}
+	if raw := os.Getenv("JWT_ACCEPTED_ALGS"); raw != "" {
+		cfg.AcceptedAlgs = nil
+		for _, alg := range strings.Split(raw, ",") {
+			alg = strings.TrimSpace(alg)
+			if !slices.Contains(supportedAlgs, alg) {
+				return fmt.Errorf("unsupported algorithm %q in JWT_ACCEPTED_ALGS (expected %s)", alg, strings.Join(supportedAlgs, ", "))
+			}
+			cfg.AcceptedAlgs = append(cfg.AcceptedAlgs, alg)
+		}
+		if !slices.Contains(cfg.AcceptedAlgs, cfg.Algorithm) {
+			return fmt.Errorf("JWT_ACCEPTED_ALGS must include JWT_ALG %s", cfg.Algorithm)
+		}
+	}
+
+	for _, alg := range cfg.AcceptedAlgs {
+		switch {
+		case alg == AlgRS256 && cfg.PublicKey == nil:
+			return errors.New("RS256 is accepted but JWT_PUBLIC_KEY_PATH is not set")
+		case alg == AlgEdDSA && cfg.EdPublicKey == nil:
+			return errors.New("EdDSA is accepted but JWT_ED25519_PUBLIC_KEY_PATH is not set")
+		}
+	}
+	return nil
+}
+
+// acceptedAlgs falls back to the signing algorithm, then HS256, for configs
+// passed to SetJWTConfig without an allowlist.
+func (cfg *JWTConfig) acceptedAlgs() []string {
+	switch {
+	case len(cfg.AcceptedAlgs) > 0:
+		return cfg.AcceptedAlgs
+	case cfg.Algorithm != "":
+		return []string{cfg.Algorithm}
+	}
+	return []string{AlgHS256}
+}
+
+func (cfg *JWTConfig) usesAlg(alg string) bool {
+	return cfg.Algorithm == alg || slices.Contains(cfg.AcceptedAlgs, alg)
+}
+
+// verificationKey picks the key by the token's algorithm. jwt.WithValidMethods
+// has already checked that algorithm against AcceptedAlgs.
+func (cfg *JWTConfig) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return cfg.hmacVerificationKey(token)
+	case *jwt.SigningMethodRSA:
+		if cfg.PublicKey != nil {
+			return cfg.PublicKey, nil
+		}
+	case *jwt.SigningMethodEd25519:
+		if cfg.EdPublicKey != nil {
+			return cfg.EdPublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+}
+
+func (cfg *JWTConfig) hmacSigningKey() (string, []byte) {
+	if cfg.Keys == nil {
+		return "", cfg.Secret
+	}
+	return cfg.ActiveKID, cfg.Keys[cfg.ActiveKID]
+}
+
+// hmacVerificationKey refuses non-HMAC tokens itself rather than relying only on
+// WithValidMethods, so the secret is never handed out for another algorithm.
+func (cfg *JWTConfig) hmacVerificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	if cfg.Keys == nil {
+		return cfg.Secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	secret, ok := cfg.Keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return secret, nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateJWTRejectsAlgNone(t *testing.T) {
+	t.Setenv("SECRET_KEY", strings.Repeat("s", 32))
+	if err := LoadJWTConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := GenerateAccessToken(1, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(signed); err != nil {
+		t.Fatalf("ValidateJWT(signed token) = %v", err)
+	}
+
+	_, payload, _ := strings.Cut(signed, ".")
+	payload, _, _ = strings.Cut(payload, ".")
+	unsigned := func(header string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + payload + "."
+	}
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user_id": 1, "role": "admin"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"none", unsigned(`{"alg":"none","typ":"JWT"}`)},
+		{"mixed case", unsigned(`{"alg":"nOnE","typ":"JWT"}`)},
+		{"with signature", unsigned(`{"alg":"none"}`) + strings.Split(signed, ".")[2]},
+		{"built by jwt library", none},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateJWT(tt.token)
+			if !errors.Is(err, ErrAlgNone) {
+				t.Errorf("ValidateJWT() error = %v, want %v", err, ErrAlgNone)
+			}
+			if claims != nil {
+				t.Errorf("ValidateJWT() claims = %+v, want nil", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package utils
+
+import "sync/atomic"
+
+var maintenanceMode atomic.Bool
+
+func MaintenanceMode() bool {
+	return maintenanceMode.Load()
+}
+
+// SetMaintenanceMode is called at startup with MAINTENANCE_MODE and by the
+// admin endpoint at runtime; runtime changes are not persisted.
+func SetMaintenanceMode(enabled bool) {
+	maintenanceMode.Store(enabled)
+}
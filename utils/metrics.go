@@ -0,0 +1,37 @@
+package utils
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	LoginTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_total",
+		Help: "Password login attempts by result.",
+	}, []string{"result"})
+
+	RefreshTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_refresh_total",
+		Help: "Refresh token exchanges by result.",
+	}, []string{"result"})
+
+	JWTValidationFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_jwt_validation_failures_total",
+		Help: "Access tokens rejected by ValidateJWT.",
+	})
+
+	ApiKeyRateLimitedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_api_key_rate_limited_total",
+		Help: "API key requests rejected for exceeding the key's rate limit.",
+	})
+
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Handler latency by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// RegisterMetrics registers the collectors above with the default registry. It
+// must be called once at startup.
+func RegisterMetrics() {
+	prometheus.MustRegister(LoginTotal, RefreshTotal, JWTValidationFailuresTotal, ApiKeyRateLimitedTotal, RequestDuration)
+}
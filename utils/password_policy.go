@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Password rules, as reported in PasswordPolicyError.Rule.
+const (
+	PasswordRuleMinLength = "min"
+	PasswordRuleUpper     = "uppercase"
+	PasswordRuleLower     = "lowercase"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSymbol    = "symbol"
+	PasswordRuleBreached  = "breached"
+)
+
+// PasswordPolicy is what ValidatePasswordStrength checks. Denylist holds
+// lower-cased passwords known from breaches.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	Denylist      map[string]struct{}
+}
+
+var passwordPolicy = PasswordPolicy{MinLength: defaultPasswordMinLength}
+
+// PasswordPolicyError names the first rule a password failed.
+type PasswordPolicyError struct {
+	Rule    string
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+// LoadPasswordPolicy reads PASSWORD_MIN_LENGTH, PASSWORD_REQUIRE_UPPER,
+// PASSWORD_REQUIRE_LOWER, PASSWORD_REQUIRE_DIGIT, PASSWORD_REQUIRE_SYMBOL and
+// PASSWORD_DENYLIST_PATH, a file with one breached password per line.
+func LoadPasswordPolicy() error {
+	var policy PasswordPolicy
+	var errs []error
+	var err error
+	if policy.MinLength, err = envIntInRange("PASSWORD_MIN_LENGTH", defaultPasswordMinLength, 1, 128); err != nil {
+		errs = append(errs, err)
+	}
+	for _, rule := range []struct {
+		key   string
+		value *bool
+	}{
+		{"PASSWORD_REQUIRE_UPPER", &policy.RequireUpper},
+		{"PASSWORD_REQUIRE_LOWER", &policy.RequireLower},
+		{"PASSWORD_REQUIRE_DIGIT", &policy.RequireDigit},
+		{"PASSWORD_REQUIRE_SYMBOL", &policy.RequireSymbol},
+	} {
+		if *rule.value, err = envBool(rule.key, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if path := os.Getenv("PASSWORD_DENYLIST_PATH"); path != "" {
+		denylist, err := loadPasswordDenylist(path)
+		if err != nil {
+			return fmt.Errorf("failed to read PASSWORD_DENYLIST_PATH: %w", err)
+		}
+		policy.Denylist = denylist
+	}
+
+	passwordPolicy = policy
+	return nil
+}
+
+func loadPasswordDenylist(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	denylist := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			denylist[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	return denylist, scanner.Err()
+}
+
+// ValidatePasswordStrength checks pw against the loaded policy and returns a
+// *PasswordPolicyError for the first rule it fails.
+func ValidatePasswordStrength(pw string) error {
+	policy := passwordPolicy
+
+	if len([]rune(pw)) < policy.MinLength {
+		return &PasswordPolicyError{PasswordRuleMinLength, fmt.Sprintf("password must be at least %d characters", policy.MinLength)}
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	switch {
+	case policy.RequireUpper && !hasUpper:
+		return &PasswordPolicyError{PasswordRuleUpper, "password must contain an uppercase letter"}
+	case policy.RequireLower && !hasLower:
+		return &PasswordPolicyError{PasswordRuleLower, "password must contain a lowercase letter"}
+	case policy.RequireDigit && !hasDigit:
+		return &PasswordPolicyError{PasswordRuleDigit, "password must contain a digit"}
+	case policy.RequireSymbol && !hasSymbol:
+		return &PasswordPolicyError{PasswordRuleSymbol, "password must contain a symbol"}
+	}
+
+	if _, breached := policy.Denylist[strings.ToLower(pw)]; breached {
+		return &PasswordPolicyError{PasswordRuleBreached, "password appears in a list of breached passwords"}
+	}
+	return nil
+}
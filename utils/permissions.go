@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PermissionAll grants every permission.
+const PermissionAll = "*"
+
+// rolePermissions maps roles to their permissions; see LoadRolePermissions.
+var rolePermissions = map[string][]string{"admin": {PermissionAll}}
+
+// LoadRolePermissions reads ROLE_PERMISSIONS, semicolon-separated
+// role=permission,... entries such as "user=apikey:create;admin=*". A listed
+// role gets exactly those permissions; admin keeps "*" unless it is listed.
+// Permissions are resource:action, with "*" as a wildcard for either part.
+func LoadRolePermissions() error {
+	permissions := map[string][]string{"admin": {PermissionAll}}
+	for _, entry := range strings.Split(os.Getenv("ROLE_PERMISSIONS"), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		role, list, found := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !found || role == "" {
+			return fmt.Errorf("invalid ROLE_PERMISSIONS entry %q (expected role=permission,...)", entry)
+		}
+
+		granted := []string{}
+		for _, permission := range splitList(list) {
+			if !ValidPermission(permission) {
+				return fmt.Errorf("invalid permission %q for role %s in ROLE_PERMISSIONS (expected resource:action)", permission, role)
+			}
+			granted = append(granted, permission)
+		}
+		permissions[role] = granted
+	}
+
+	rolePermissions = permissions
+	return nil
+}
+
+// RolePermissions returns the permissions role grants.
+func RolePermissions(role string) []string {
+	return rolePermissions[role]
+}
+
+// ValidPermission accepts "*" and resource:action, either part possibly "*".
+func ValidPermission(permission string) bool {
+	if permission == PermissionAll {
+		return true
+	}
+	resource, action, found := strings.Cut(permission, ":")
+	return found && resource != "" && action != "" && !strings.ContainsAny(permission, " ,;=") && !strings.Contains(action, ":")
+}
+
+// PermissionGranted reports whether any of granted covers required, so "*"
+// and "user:*" both cover "user:delete".
+func PermissionGranted(granted []string, required string) bool {
+	resource, action, _ := strings.Cut(required, ":")
+	for _, permission := range granted {
+		if permission == PermissionAll || permission == required {
+			return true
+		}
+		grantedResource, grantedAction, _ := strings.Cut(permission, ":")
+		if (grantedResource == PermissionAll || grantedResource == resource) && (grantedAction == PermissionAll || grantedAction == action) {
+			return true
+		}
+	}
+	return false
+}
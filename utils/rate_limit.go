@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitStore counts hits per key in fixed windows. MemoryRateLimitStore is
+// enough for a single instance; a shared backend such as Redis can implement the
+// same interface when the service is scaled out.
+type RateLimitStore interface {
+	Increment(key string, window time.Duration) (count int, resetAt time.Time)
+}
+
+type rateLimitEntry struct {
+	count   int
+	resetAt time.Time
+}
+
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]*rateLimitEntry
+}
+
+// NewMemoryRateLimitStore starts a goroutine that drops expired windows every
+// cleanupInterval so idle keys don't accumulate.
+func NewMemoryRateLimitStore(cleanupInterval time.Duration) *MemoryRateLimitStore {
+	store := &MemoryRateLimitStore{
+		entries: map[string]*rateLimitEntry{},
+	}
+	go store.cleanup(cleanupInterval)
+	return store
+}
+
+func (s *MemoryRateLimitStore) Increment(key string, window time.Duration) (int, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.resetAt) {
+		entry = &rateLimitEntry{resetAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+
+	return entry.count, entry.resetAt
+}
+
+func (s *MemoryRateLimitStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for key, entry := range s.entries {
+			if !now.Before(entry.resetAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// RefreshJWTType is the typ header of refresh JWTs. ValidateJWT refuses it, so
+// a refresh token can't be used as an access token, and ValidateRefreshJWT
+// requires it.
+const RefreshJWTType = "refresh+jwt"
+
+// RefreshClaims are the claims of a refresh JWT. The fingerprint hashes bind
+// the token to the client it was issued to, as the row does for opaque tokens.
+// Client keeps the access token audience across refreshes; the refresh JWT
+// itself always has JWT_AUDIENCE.
+type RefreshClaims struct {
+	UserID        uint   `json:"user_id"`
+	Client        string `json:"client,omitempty"`
+	UserAgentHash string `json:"uah,omitempty"`
+	IPHash        string `json:"iph,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *RefreshClaims) Fingerprint() ClientFingerprint {
+	return ClientFingerprint{UserAgentHash: c.UserAgentHash, IPHash: c.IPHash}
+}
+
+// GenerateRefreshJWT signs a refresh token valid for ttl with the access token
+// keys and algorithm.
+func GenerateRefreshJWT(userID uint, client string, fingerprint ClientFingerprint, ttl time.Duration) (string, *RefreshClaims, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &RefreshClaims{
+		UserID:        userID,
+		Client:        client,
+		UserAgentHash: fingerprint.UserAgentHash,
+		IPHash:        fingerprint.IPHash,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	if cfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{cfg.Audience}
+	}
+
+	token, err := signToken(cfg, cfg.Algorithm, claims, RefreshJWTType)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// ValidateRefreshJWT checks a refresh JWT like ValidateJWT does an access
+// token, but only with our own keys: trusted issuers can't mint refresh
+// tokens. Checking its jti against a revocation list is up to the caller.
+func ValidateRefreshJWT(signedToken string) (*RefreshClaims, error) {
+	cfg, err := currentJWTConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectAlgNone(signedToken); err != nil {
+		return nil, err
+	}
+
+	claims := &RefreshClaims{}
+	var audiences []string
+	if cfg.Audience != "" {
+		audiences = []string{cfg.Audience}
+	}
+	token, err := parseJWT(signedToken, claims, cfg.verificationKey, cfg.parserOptions(audiences))
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := token.Header["typ"].(string); typ != RefreshJWTType {
+		return nil, fmt.Errorf("%w: not a refresh token", jwt.ErrTokenInvalidClaims)
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing jti", jwt.ErrTokenInvalidClaims)
+	}
+	return claims, nil
+}
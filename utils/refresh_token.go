@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+var refreshTokenBytes = 32
+
+// SetRefreshTokenBytes applies REFRESH_TOKEN_BYTES once at startup; config.Load
+// has already checked that it is at least 16.
+func SetRefreshTokenBytes(size int) {
+	refreshTokenBytes = size
+}
+
+// GenerateRefreshToken returns REFRESH_TOKEN_BYTES (32 by default) random
+// bytes, base64url encoded. Only HashRefreshToken of it is stored.
+func GenerateRefreshToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken is unsalted on purpose: the token has enough entropy on its
+// own, and a deterministic hash can be looked up through the unique index.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
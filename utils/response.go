@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error codes returned in the "code" field of error responses.
+const (
+	CodeInvalidPayload   = "invalid_payload"
+	CodeValidationFailed = "validation_failed"
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeTokenExpired     = "token_expired"
+	CodeTokenMalformed   = "token_malformed"
+	CodeTokenInvalid     = "token_invalid"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeAccountLocked    = "account_locked"
+	CodeAccountInactive  = "account_inactive"
+	CodeEmailNotVerified = "email_not_verified"
+	CodeMaintenance      = "maintenance"
+	CodeTimeout          = "timeout"
+	CodeInternalError    = "internal_error"
+)
+
+type ErrorBody struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// ErrorResponse writes {"error": {"code": ..., "message": ...}} with the given
+// status, or the text/plain form when the client asks for it.
+func ErrorResponse(c *fiber.Ctx, status int, code, message string) error {
+	return FieldErrorResponse(c, status, code, message, nil)
+}
+
+func FieldErrorResponse(c *fiber.Ctx, status int, code, message string, fields map[string]string) error {
+	body := ErrorBody{
+		Code:    code,
+		Message: message,
+		Fields:  fields,
+	}
+
+	if prefersPlainText(c) {
+		return c.Status(status).SendString(body.String())
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": body,
+	})
+}
+
+// String renders the body as "code: message" followed by one "field: tag" line
+// per field, sorted by field name.
+func (b ErrorBody) String() string {
+	var sb strings.Builder
+	sb.WriteString(b.Code + ": " + b.Message + "\n")
+
+	names := make([]string, 0, len(b.Fields))
+	for name := range b.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString(name + ": " + b.Fields[name] + "\n")
+	}
+	return sb.String()
+}
+
+// prefersPlainText is true only when the Accept header ranks text/plain above
+// application/json. A missing header, */* or anything else gets JSON.
+func prefersPlainText(c *fiber.Ctx) bool {
+	return c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextPlain) == fiber.MIMETextPlain
+}
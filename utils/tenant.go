@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var ErrTenantNotFound = errors.New("tenant not found in context")
+
+// RequireTenant is a gorm scope limiting a query to the tenant AuthMiddleware
+// stored for the caller. Without one the query fails rather than reading
+// across tenants.
+func RequireTenant(c *fiber.Ctx) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tenantID, ok := c.Locals("tenantID").(uint)
+		if !ok {
+			_ = db.AddError(ErrTenantNotFound)
+			return db
+		}
+		return db.Where("tenant_id = ?", tenantID)
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TrustedIssuer is an external identity provider whose tokens ValidateJWT
+// accepts next to our own. Its tokens never map to a local user: UserID is
+// always 0, Role and TenantID come from this config rather than the token, and
+// the provider's subject stays in the sub claim. WithFreshUserCheck has no user
+// to load for them and keeps the configured Role and TenantID.
+type TrustedIssuer struct {
+	Issuer string `json:"issuer"`
+	// Alg is HS256, RS256 or EdDSA. The key is Secret for HS256 and the PEM
+	// file at PublicKeyPath otherwise. RS256 issuers without a key file are
+	// verified against JWKSURL, by default <issuer>/.well-known/jwks.json.
+	Alg           string `json:"alg"`
+	Secret        string `json:"secret"`
+	PublicKeyPath string `json:"public_key_path"`
+	JWKSURL       string `json:"jwks_url"`
+	// Audience defaults to JWT_AUDIENCE.
+	Audience string `json:"audience"`
+	Role     string `json:"role"`
+	TenantID uint   `json:"tenant_id"`
+
+	key  interface{}
+	jwks *JWKSCache
+}
+
+// loadTrustedIssuers reads JWT_TRUSTED_ISSUERS, a JSON array of
+// TrustedIssuer, or the file named by JWT_TRUSTED_ISSUERS_FILE.
+func (cfg *JWTConfig) loadTrustedIssuers() error {
+	raw := []byte(os.Getenv("JWT_TRUSTED_ISSUERS"))
+	if path := os.Getenv("JWT_TRUSTED_ISSUERS_FILE"); path != "" {
+		if len(raw) > 0 {
+			return errors.New("set only one of JWT_TRUSTED_ISSUERS and JWT_TRUSTED_ISSUERS_FILE")
+		}
+		var err error
+		if raw, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read JWT_TRUSTED_ISSUERS_FILE: %w", err)
+		}
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var issuers []*TrustedIssuer
+	if err := json.Unmarshal(raw, &issuers); err != nil {
+		return fmt.Errorf("invalid trusted issuers: %w", err)
+	}
+
+	cfg.TrustedIssuers = make(map[string]*TrustedIssuer, len(issuers))
+	for _, issuer := range issuers {
+		if err := issuer.loadKey(); err != nil {
+			return fmt.Errorf("trusted issuer %q: %w", issuer.Issuer, err)
+		}
+		if issuer.Issuer == cfg.Issuer {
+			return fmt.Errorf("trusted issuer %q is our own JWT_ISSUER", issuer.Issuer)
+		}
+		if _, dup := cfg.TrustedIssuers[issuer.Issuer]; dup {
+			return fmt.Errorf("trusted issuer %q is listed twice", issuer.Issuer)
+		}
+		cfg.TrustedIssuers[issuer.Issuer] = issuer
+	}
+	return nil
+}
+
+func (ti *TrustedIssuer) loadKey() error {
+	if ti.Issuer == "" {
+		return errors.New("issuer is required")
+	}
+	if ti.Alg == AlgRS256 && ti.PublicKeyPath == "" {
+		if ti.JWKSURL == "" {
+			ti.JWKSURL = strings.TrimSuffix(ti.Issuer, "/") + "/.well-known/jwks.json"
+		}
+		ttl, err := envDuration("JWKS_CACHE_TTL", time.Hour)
+		if err != nil {
+			return err
+		}
+		ti.jwks = NewJWKSCache(ti.JWKSURL, ttl)
+		return nil
+	}
+	if ti.JWKSURL != "" {
+		return errors.New("jwks_url needs alg RS256 and no public_key_path")
+	}
+
+	if ti.Alg == AlgHS256 {
+		if len(ti.Secret) < minSecretBytes {
+			return fmt.Errorf("secret must be at least %d bytes", minSecretBytes)
+		}
+		ti.key = []byte(ti.Secret)
+		return nil
+	}
+
+	if ti.PublicKeyPath == "" {
+		return errors.New("public_key_path is required")
+	}
+	pem, err := os.ReadFile(ti.PublicKeyPath)
+	if err != nil {
+		return err
+	}
+	switch ti.Alg {
+	case AlgRS256:
+		ti.key, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+	case AlgEdDSA:
+		ti.key, err = jwt.ParseEdPublicKeyFromPEM(pem)
+	default:
+		return fmt.Errorf("unsupported alg %q", ti.Alg)
+	}
+	return err
+}
+
+// trustedIssuerFor peeks at the unverified iss claim to pick the issuer whose
+// key must then verify the token. Tokens naming our own issuer, or none, are
+// left to our keys.
+func (cfg *JWTConfig) trustedIssuerFor(signedToken string) *TrustedIssuer {
+	if len(cfg.TrustedIssuers) == 0 {
+		return nil
+	}
+
+	var unverified jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(signedToken, &unverified); err != nil {
+		return nil
+	}
+	if unverified.Issuer == "" || unverified.Issuer == cfg.Issuer {
+		return nil
+	}
+	return cfg.TrustedIssuers[unverified.Issuer]
+}
+
+func (ti *TrustedIssuer) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != ti.Alg {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	if ti.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid")
+		}
+		return ti.jwks.Key(kid)
+	}
+	return ti.key, nil
+}
+
+func (ti *TrustedIssuer) parserOptions(cfg *JWTConfig) []jwt.ParserOption {
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{ti.Alg}), jwt.WithIssuer(ti.Issuer)}
+	audience := ti.Audience
+	if audience == "" {
+		audience = cfg.Audience
+	}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+	return options
+}
+
+// localize replaces the identity claims of an external token so it can't pass
+// for one of our users.
+func (ti *TrustedIssuer) localize(claims *Claims) {
+	claims.UserID = 0
+	claims.Role = ti.Role
+	claims.Extra = map[string]any{"tenant_id": ti.TenantID}
+	claims.External = true
+}